@@ -3,21 +3,22 @@ package application
 import (
 	"context"
 	"erinaceus_data_feeds/client"
+	"erinaceus_data_feeds/config"
 	"erinaceus_data_feeds/headtracker"
-	logpoller "erinaceus_data_feeds/logPoller"
-	"erinaceus_data_feeds/services/timer"
+	"erinaceus_data_feeds/job"
+	"erinaceus_data_feeds/services/feedmanager"
+	"erinaceus_data_feeds/services/fetcher"
+	"erinaceus_data_feeds/services/txmanager"
 	wallet_service "erinaceus_data_feeds/services/wallet"
-	"erinaceus_data_feeds/utils"
-	"flag"
+	"erinaceus_data_feeds/services/withdrawer"
+	"erinaceus_data_feeds/utils/redact"
 	"fmt"
 	"os"
-	"path/filepath"
+	"time"
 
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/sirupsen/logrus"
 )
 
-var replayFromBlock = uint64(1000000) // default number of replay blocks
 // CustomFormatter is a Logrus formatter that adds two newline characters to log entries.
 type CustomFormatter struct {
 	logrus.JSONFormatter
@@ -32,54 +33,84 @@ func (f *CustomFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	return append(data, '\n'), nil
 }
 
+// NewLogger builds the logger shared by every service from the log config.
+func NewLogger(cfg config.Log) (*logrus.Logger, error) {
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	logger := logrus.New()
+	logger.SetOutput(os.Stdout)
+	logger.SetLevel(level)
+	if cfg.Format == "text" {
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	} else {
+		logger.SetFormatter(&CustomFormatter{})
+	}
+	return logger, nil
+}
+
 type Application struct {
+	Config        *config.Config
 	Client        *client.Client
-	LogPoller     *logpoller.LogPoller
+	FeedManager   *feedmanager.FeedManager
 	WalletService *wallet_service.WalletService
 	Logger        *logrus.Logger
 	HeadTracker   *headtracker.HeadTracker
+	// Withdrawer is nil when withdrawals are disabled.
+	Withdrawer *withdrawer.Withdrawer
+	TxManager  *txmanager.TxManager
 }
 
-func NewApplication() (*Application, error) {
-	logger := logrus.New()
-	logger.SetOutput(os.Stdout)
-	logger.SetFormatter(&CustomFormatter{})
-	wd, err := os.Getwd()
+func NewApplication(cfg *config.Config) (*Application, error) {
+	feeds, err := job.LoadFeeds(cfg)
 	if err != nil {
-		logrus.Fatalf("failed to get working directory %v", err)
-		return nil, err
+		return nil, fmt.Errorf("failed to load feeds : Err=<%v>", err)
 	}
-	useConfig := flag.Bool("with-config", false, "Set to true to use configuration file")
-	flag.Parse()
-	if *useConfig {
-		if err := utils.LoadEnv(filepath.Join(wd, "/.env")); err != nil {
-			return nil, fmt.Errorf("failed to set env variables from .env %v", err)
-		}
+	logger, err := NewLogger(cfg.Log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create logger : Err=<%v>", err)
+	}
+	secrets := append([]string{cfg.Keys.Password}, cfg.HTTP.Secrets()...)
+	for _, feed := range feeds {
+		secrets = append(secrets, feed.Secrets()...)
 	}
-	client, err := client.NewClient()
+	logger.AddHook(redact.NewHook(secrets...))
+	client, err := client.NewClient(cfg.Node.URL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create application : Err=<%v>", err)
 	}
-	walletService := wallet_service.NewWalletService(client)
-	contractAddress := common.HexToAddress(os.Getenv("EC_FEED_ADDRESS"))
-	timer, _ := timer.NewTimerService()
-
-	logpoller, err := logpoller.NewLogPoller(client, replayFromBlock, contractAddress, walletService, timer)
+	walletService := wallet_service.NewWalletService(client, cfg.Keys)
+	httpFetcher, err := fetcher.New(cfg.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http fetcher : Err=<%v>", err)
+	}
 
+	// Every transaction of the key goes through a single manager owning its
+	// nonce.
+	txManager := txmanager.NewTxManager(client, cfg.Node.ChainID, cfg.TxManager, walletService, logger)
+	feedManager, err := feedmanager.NewFeedManager(client, feeds, walletService, txManager, httpFetcher, logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create log poller : Err=<%v>", err)
+		return nil, fmt.Errorf("failed to create feed manager : Err=<%v>", err)
+	}
+	headTracker := headtracker.NewHeadTracker(client, feedManager.LogPollers(), logger)
+	var paymentWithdrawer *withdrawer.Withdrawer
+	if cfg.Withdrawal.Enabled {
+		paymentWithdrawer, err = withdrawer.NewWithdrawer(client, cfg.Withdrawal, feeds, walletService, txManager, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create withdrawer : Err=<%v>", err)
+		}
 	}
-	headTracker := headtracker.NewHeadTracker(client, logpoller)
-	go timer.Start()
-	go logpoller.StartPollingLogs()
-	go headTracker.Start(context.Background())
 
 	return &Application{
+		Config:        cfg,
 		Client:        client,
-		LogPoller:     logpoller,
+		FeedManager:   feedManager,
 		WalletService: walletService,
 		HeadTracker:   headTracker,
+		TxManager:     txManager,
 		Logger:        logger,
+		Withdrawer:    paymentWithdrawer,
 	}, nil
 }
 
@@ -89,5 +120,23 @@ func (app *Application) Run() {
 		app.Logger.Errorf("failed to create FTN Key %v", err)
 	}
 	app.WalletService.PrintWalletDetails()
-	app.LogPoller.StartListeningForPrices()
+	app.FeedManager.Start()
+	go app.TxManager.Start(context.Background())
+	go app.HeadTracker.Start(context.Background())
+	if app.Withdrawer != nil {
+		go app.Withdrawer.Start(context.Background())
+	}
+	if interval := app.Config.Log.StatusInterval.D(); interval > 0 {
+		go app.logStatus(interval)
+	}
+	select {}
+}
+
+// logStatus logs the status of the feeds every interval.
+func (app *Application) logStatus(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		app.FeedManager.LogStatus()
+	}
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"math/big"
-	"os"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
@@ -36,12 +35,24 @@ func (cl *Client) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64
 	return cl.EthClient.EstimateGas(ctx, msg)
 }
 
+func (cl *Client) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return cl.EthClient.SuggestGasPrice(ctx)
+}
+
+func (cl *Client) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	return cl.EthClient.TransactionReceipt(ctx, hash)
+}
+
+func (cl *Client) BlockNumber(ctx context.Context) (uint64, error) {
+	return cl.EthClient.BlockNumber(ctx)
+}
+
 func (cl *Client) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
 	return cl.EthClient.SubscribeNewHead(ctx, ch)
 }
 
-func NewClient() (*Client, error) {
-	client, err := ethclient.Dial(os.Getenv("EC_NODE_URL"))
+func NewClient(url string) (*Client, error) {
+	client, err := ethclient.Dial(url)
 	if err != nil {
 		fmt.Println("Failed to connect to the Ethereum client:", err)
 
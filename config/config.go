@@ -0,0 +1,556 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	ubig "erinaceus_data_feeds/utils/big"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/multierr"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the typed configuration of a data feeds node. It is loaded from a
+// TOML or YAML file and every field tagged with `env` can be overridden by the
+// environment variable of that name.
+type Config struct {
+	Node Node `toml:"node" yaml:"node"`
+	// Feed configures a single feed. It is ignored when Feeds is set.
+	Feed  Feed   `toml:"feed" yaml:"feed"`
+	Feeds []Feed `toml:"feeds" yaml:"feeds"`
+	// JobSpecs is a directory or glob of flux monitor job spec files, each
+	// adding one feed.
+	JobSpecs string `toml:"job_specs" yaml:"job_specs" env:"EC_JOB_SPECS"`
+	Keys     Keys   `toml:"keys" yaml:"keys"`
+	Log      Log    `toml:"log" yaml:"log"`
+	HTTP     HTTP   `toml:"http" yaml:"http"`
+	// Withdrawal withdraws the payments earned on every feed.
+	Withdrawal Withdrawal `toml:"withdrawal" yaml:"withdrawal"`
+	TxManager  TxManager  `toml:"tx_manager" yaml:"tx_manager"`
+}
+
+// AllFeeds returns the feeds configured in the config itself: every entry of
+// Feeds, or the single Feed when no list is configured. Feeds defined by job
+// specs are not included.
+func (c *Config) AllFeeds() []Feed {
+	if len(c.Feeds) > 0 {
+		return c.Feeds
+	}
+	if c.singleFeedSkipped() {
+		return nil
+	}
+	return []Feed{c.Feed}
+}
+
+// singleFeedSkipped reports whether the single Feed is left unconfigured
+// because job specs provide the feeds.
+func (c *Config) singleFeedSkipped() bool {
+	return c.JobSpecs != "" && c.Feed.Address == ""
+}
+
+// Node holds the connection details of the chain the feeds are submitted to.
+type Node struct {
+	URL     string `toml:"url" yaml:"url" env:"EC_NODE_URL"`
+	ChainID int64  `toml:"chain_id" yaml:"chain_id" env:"EC_CHAIN_ID"`
+}
+
+// Keys locates the encrypted FTN transmitter key.
+type Keys struct {
+	JSONPath string `toml:"json_path" yaml:"json_path" env:"EC_FTN_KEY_JSON_PATH"`
+	Password string `toml:"password" yaml:"password" env:"EC_FTN_KEY_PASSWORD"`
+}
+
+// Log configures the process wide logger.
+type Log struct {
+	Level  string `toml:"level" yaml:"level" env:"EC_LOG_LEVEL"`
+	Format string `toml:"format" yaml:"format" env:"EC_LOG_FORMAT"`
+	// StatusInterval is the period of the status line logged for every feed,
+	// zero to disable it.
+	StatusInterval Duration `toml:"status_interval" yaml:"status_interval" env:"EC_LOG_STATUS_INTERVAL"`
+}
+
+// TxManager configures how the transactions of the transmitter are sent and
+// replaced while they stay unmined.
+type TxManager struct {
+	// BumpAfterBlocks is the number of blocks a transaction may stay unmined
+	// before it is rebroadcast with a bumped gas price.
+	BumpAfterBlocks uint64 `toml:"bump_after_blocks" yaml:"bump_after_blocks" env:"EC_TX_BUMP_AFTER_BLOCKS"`
+	// BumpPercent is the gas price increase of a rebroadcast, at least the
+	// 10 percent nodes require to replace a transaction.
+	BumpPercent uint64 `toml:"bump_percent" yaml:"bump_percent" env:"EC_TX_BUMP_PERCENT"`
+	// MaxGasPrice caps the gas price, in wei, unbounded when zero.
+	MaxGasPrice ubig.Big `toml:"max_gas_price" yaml:"max_gas_price" env:"EC_TX_MAX_GAS_PRICE"`
+	// PollInterval is the period receipts are checked at.
+	PollInterval Duration `toml:"poll_interval" yaml:"poll_interval" env:"EC_TX_POLL_INTERVAL"`
+}
+
+func (t TxManager) validate() (err error) {
+	if t.BumpAfterBlocks < 1 {
+		err = multierr.Append(err, invalid("tx_manager.bump_after_blocks", "must be at least 1, got %d", t.BumpAfterBlocks))
+	}
+	if t.BumpPercent < 10 {
+		err = multierr.Append(err, invalid("tx_manager.bump_percent", "must be at least 10, got %d", t.BumpPercent))
+	}
+	if t.MaxGasPrice.ToInt().Sign() < 0 {
+		err = multierr.Append(err, invalid("tx_manager.max_gas_price", "must not be negative, got %s", t.MaxGasPrice.ToInt()))
+	}
+	if t.PollInterval <= 0 {
+		err = multierr.Append(err, invalid("tx_manager.poll_interval", "must be positive, got %s", t.PollInterval))
+	}
+	return err
+}
+
+// Withdrawal checks the payment withdrawable from every feed each Interval
+// and withdraws it to Payee once it exceeds Threshold. The transmitter key
+// sends the withdrawals, so it must be the admin of the oracle.
+type Withdrawal struct {
+	Enabled  bool     `toml:"enabled" yaml:"enabled" env:"EC_WITHDRAWAL_ENABLED"`
+	Interval Duration `toml:"interval" yaml:"interval" env:"EC_WITHDRAWAL_INTERVAL"`
+	// Threshold is the withdrawable payment, in wei, to exceed.
+	Threshold ubig.Big `toml:"threshold" yaml:"threshold" env:"EC_WITHDRAWAL_THRESHOLD"`
+	// Payee receives the withdrawals. It defaults to the transmitter.
+	Payee string `toml:"payee" yaml:"payee" env:"EC_WITHDRAWAL_PAYEE"`
+	// JournalPath is the file every withdrawal transaction is appended to.
+	JournalPath string `toml:"journal_path" yaml:"journal_path" env:"EC_WITHDRAWAL_JOURNAL_PATH"`
+}
+
+func (w Withdrawal) validate() (err error) {
+	if !w.Enabled {
+		return nil
+	}
+	if w.Interval <= 0 {
+		err = multierr.Append(err, invalid("withdrawal.interval", "must be positive, got %s", w.Interval))
+	}
+	if w.Threshold.ToInt().Sign() < 0 {
+		err = multierr.Append(err, invalid("withdrawal.threshold", "must not be negative, got %s", w.Threshold.ToInt()))
+	}
+	if w.Payee != "" {
+		err = multierr.Append(err, validateAddress("withdrawal.payee", w.Payee))
+	}
+	if w.JournalPath == "" {
+		err = multierr.Append(err, invalid("withdrawal.journal_path", "must be set"))
+	}
+	return err
+}
+
+// HTTP configures the client shared by every HTTP price source.
+type HTTP struct {
+	// RequestTimeout bounds each attempt. All attempts of a fetch are also
+	// bounded by the timeout of the source.
+	RequestTimeout Duration `toml:"request_timeout" yaml:"request_timeout" env:"EC_HTTP_REQUEST_TIMEOUT"`
+	// Retries is the number of attempts made after a failed one. Timeouts,
+	// network errors, HTTP 429 and 5xx responses are retried.
+	Retries int `toml:"retries" yaml:"retries" env:"EC_HTTP_RETRIES"`
+	// RetryBackoff and MaxRetryBackoff bound the jittered exponential delay
+	// between attempts.
+	RetryBackoff    Duration `toml:"retry_backoff" yaml:"retry_backoff" env:"EC_HTTP_RETRY_BACKOFF"`
+	MaxRetryBackoff Duration `toml:"max_retry_backoff" yaml:"max_retry_backoff" env:"EC_HTTP_MAX_RETRY_BACKOFF"`
+	// MaxResponseSize is the largest response body read, in bytes.
+	MaxResponseSize int64 `toml:"max_response_size" yaml:"max_response_size" env:"EC_HTTP_MAX_RESPONSE_SIZE"`
+	// Proxy is the URL of the proxy requests go through. The standard proxy
+	// environment variables are used when it is empty.
+	Proxy string `toml:"proxy" yaml:"proxy" env:"EC_HTTP_PROXY"`
+	// CAFile adds PEM certificates to the trusted roots.
+	CAFile string `toml:"ca_file" yaml:"ca_file" env:"EC_HTTP_CA_FILE"`
+	// CertFile and KeyFile hold the PEM client certificate used for mTLS.
+	CertFile string `toml:"cert_file" yaml:"cert_file" env:"EC_HTTP_CERT_FILE"`
+	KeyFile  string `toml:"key_file" yaml:"key_file" env:"EC_HTTP_KEY_FILE"`
+	// CoalesceWindow is how long the response of a request is reused by
+	// identical requests. Identical requests in flight always share one
+	// response.
+	CoalesceWindow Duration `toml:"coalesce_window" yaml:"coalesce_window" env:"EC_HTTP_COALESCE_WINDOW"`
+	// RateLimits caps the request rate to providers, shared by every feed.
+	RateLimits []RateLimit `toml:"rate_limits" yaml:"rate_limits"`
+}
+
+// RateLimit is a token bucket limiting the requests to a provider host. With
+// an APIKey it only applies to the requests carrying that key, for providers
+// limiting per key.
+type RateLimit struct {
+	Host              string  `toml:"host" yaml:"host"`
+	APIKey            string  `toml:"api_key" yaml:"api_key"`
+	RequestsPerSecond float64 `toml:"requests_per_second" yaml:"requests_per_second"`
+	// Burst is the number of requests allowed at once, one when unset.
+	Burst int `toml:"burst" yaml:"burst"`
+}
+
+// Secrets returns the API keys of the rate limits.
+func (h HTTP) Secrets() []string {
+	var secrets []string
+	for _, limit := range h.RateLimits {
+		if limit.APIKey != "" {
+			secrets = append(secrets, limit.APIKey)
+		}
+	}
+	return secrets
+}
+
+// DefaultHTTP returns the HTTP settings applied when none are configured.
+func DefaultHTTP() HTTP {
+	return HTTP{
+		RequestTimeout:  Duration(5 * time.Second),
+		Retries:         2,
+		RetryBackoff:    Duration(250 * time.Millisecond),
+		MaxRetryBackoff: Duration(2 * time.Second),
+		MaxResponseSize: 1 << 20,
+		CoalesceWindow:  Duration(time.Second),
+	}
+}
+
+func (h HTTP) validate() (err error) {
+	if h.RequestTimeout <= 0 {
+		err = multierr.Append(err, invalid("http.request_timeout", "must be positive, got %s", h.RequestTimeout))
+	}
+	if h.Retries < 0 {
+		err = multierr.Append(err, invalid("http.retries", "must not be negative, got %d", h.Retries))
+	}
+	if h.RetryBackoff < 0 {
+		err = multierr.Append(err, invalid("http.retry_backoff", "must not be negative, got %s", h.RetryBackoff))
+	}
+	if h.MaxRetryBackoff < h.RetryBackoff {
+		err = multierr.Append(err, invalid("http.max_retry_backoff", "must not be less than retry_backoff, got %s", h.MaxRetryBackoff))
+	}
+	if h.MaxResponseSize <= 0 {
+		err = multierr.Append(err, invalid("http.max_response_size", "must be positive, got %d", h.MaxResponseSize))
+	}
+	if h.Proxy != "" {
+		if u, perr := url.Parse(h.Proxy); perr != nil || u.Host == "" {
+			err = multierr.Append(err, invalid("http.proxy", "must be an absolute URL, got %q", h.Proxy))
+		}
+	}
+	if (h.CertFile == "") != (h.KeyFile == "") {
+		err = multierr.Append(err, invalid("http.key_file", "cert_file and key_file must be set together"))
+	}
+	if h.CoalesceWindow < 0 {
+		err = multierr.Append(err, invalid("http.coalesce_window", "must not be negative, got %s", h.CoalesceWindow))
+	}
+	for i, limit := range h.RateLimits {
+		prefix := fmt.Sprintf("http.rate_limits[%d]", i)
+		if limit.Host == "" || strings.Contains(limit.Host, "/") {
+			err = multierr.Append(err, invalid(prefix+".host", "must be a host name, got %q", limit.Host))
+		}
+		if limit.RequestsPerSecond <= 0 {
+			err = multierr.Append(err, invalid(prefix+".requests_per_second", "must be positive, got %v", limit.RequestsPerSecond))
+		}
+		if limit.Burst < 0 {
+			err = multierr.Append(err, invalid(prefix+".burst", "must not be negative, got %d", limit.Burst))
+		}
+	}
+	return err
+}
+
+// Defaults returns a config populated with the values the node used before it
+// was configurable.
+func Defaults() *Config {
+	return &Config{
+		Node: Node{
+			ChainID: 4090,
+		},
+		Feed: DefaultFeed(),
+		Keys: Keys{
+			JSONPath: "ftn_key.json",
+		},
+		Log: Log{
+			Level:          "info",
+			Format:         "json",
+			StatusInterval: Duration(time.Minute),
+		},
+		HTTP: DefaultHTTP(),
+		Withdrawal: Withdrawal{
+			Interval:    Duration(time.Hour),
+			JournalPath: "withdrawals.jsonl",
+		},
+		TxManager: TxManager{
+			BumpAfterBlocks: 3,
+			BumpPercent:     20,
+			PollInterval:    Duration(2 * time.Second),
+		},
+	}
+}
+
+// Load builds the config from the defaults, the file at path (skipped when
+// path is empty) and the environment, in that order, and validates the result.
+func Load(path string) (*Config, error) {
+	cfg := Defaults()
+	if path != "" {
+		if err := cfg.decodeFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), "", ""); err != nil {
+		return nil, err
+	}
+	cfg.Feed.SetDefaults()
+	for i := range cfg.Feeds {
+		cfg.Feeds[i].SetDefaults()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) decodeFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %s: %v", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown field %q in config file %s", undecoded[0].String(), path)
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %v", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file extension %q, use .toml, .yaml or .yml", ext)
+	}
+	return nil
+}
+
+// Validate checks every field and returns all problems at once, each naming
+// the offending field.
+func (c *Config) Validate() (err error) {
+	if c.Node.URL == "" {
+		err = multierr.Append(err, invalid("node.url", "must be set"))
+	}
+	if c.Node.ChainID <= 0 {
+		err = multierr.Append(err, invalid("node.chain_id", "must be positive, got %d", c.Node.ChainID))
+	}
+
+	if len(c.Feeds) > 0 {
+		if c.Feed.Address != "" {
+			err = multierr.Append(err, invalid("feed.address", "cannot be combined with a feeds list"))
+		}
+		names := make(map[string]bool)
+		addresses := make(map[common.Address]bool)
+		for i, feed := range c.Feeds {
+			field := fmt.Sprintf("feeds[%d]", i)
+			err = multierr.Append(err, feed.Validate(field))
+			if names[feed.Name] {
+				err = multierr.Append(err, invalid(field+".name", "duplicate feed name %q", feed.Name))
+			}
+			names[feed.Name] = true
+			if common.IsHexAddress(feed.Address) {
+				if addresses[feed.ContractAddress()] {
+					err = multierr.Append(err, invalid(field+".address", "duplicate feed address %s", feed.Address))
+				}
+				addresses[feed.ContractAddress()] = true
+			}
+		}
+	} else if !c.singleFeedSkipped() {
+		err = multierr.Append(err, c.Feed.Validate("feed"))
+	}
+
+	if c.Keys.Password == "" {
+		err = multierr.Append(err, invalid("keys.password", "must be set"))
+	}
+
+	if _, lerr := logrus.ParseLevel(c.Log.Level); lerr != nil {
+		err = multierr.Append(err, invalid("log.level", "%v", lerr))
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		err = multierr.Append(err, invalid("log.format", `must be "json" or "text", got %q`, c.Log.Format))
+	}
+	if c.Log.StatusInterval < 0 {
+		err = multierr.Append(err, invalid("log.status_interval", "must not be negative, got %s", c.Log.StatusInterval))
+	}
+	err = multierr.Append(err, c.HTTP.validate())
+	err = multierr.Append(err, c.Withdrawal.validate())
+	err = multierr.Append(err, c.TxManager.validate())
+	return err
+}
+
+// FieldError is a single invalid configuration value.
+type FieldError struct {
+	Field string
+	Env   string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	if e.Env != "" {
+		return fmt.Sprintf("invalid config %s (%s): %s", e.Field, e.Env, e.Msg)
+	}
+	return fmt.Sprintf("invalid config %s: %s", e.Field, e.Msg)
+}
+
+func invalid(field, format string, args ...interface{}) error {
+	return &FieldError{Field: field, Env: envNames[field], Msg: fmt.Sprintf(format, args...)}
+}
+
+func validateAddress(field, value string) error {
+	if value == "" {
+		return invalid(field, "must be set")
+	}
+	if !common.IsHexAddress(value) {
+		return invalid(field, "%q is not a hex encoded address", value)
+	}
+	address := common.HexToAddress(value)
+	if address == (common.Address{}) {
+		return invalid(field, "must not be the zero address")
+	}
+	hex := strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X")
+	if hex != strings.ToLower(hex) && hex != strings.ToUpper(hex) && "0x"+hex != address.Hex() {
+		return invalid(field, "%q has an invalid EIP55 checksum, expected %s", value, address.Hex())
+	}
+	return nil
+}
+
+// Duration is a time.Duration that is written as a string such as "30s" in
+// config files and environment variables.
+type Duration time.Duration
+
+// D returns d as a time.Duration.
+func (d Duration) D() time.Duration { return time.Duration(d) }
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// envNames maps the dotted field name of every overridable field to its
+// environment variable.
+var envNames = collectEnvNames(reflect.TypeOf(Config{}), "", "", map[string]string{})
+
+// isNested reports whether a field of type t holds further fields rather than
+// a single value. The env tag of a nested field is a prefix for its children.
+func isNested(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+func envName(prefix string, f reflect.StructField) string {
+	env := f.Tag.Get("env")
+	if env == "" || prefix == "" {
+		return env
+	}
+	return prefix + "_" + env
+}
+
+func collectEnvNames(t reflect.Type, prefix, envPrefix string, names map[string]string) map[string]string {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := fieldName(prefix, f)
+		env := envName(envPrefix, f)
+		if isNested(f.Type) {
+			collectEnvNames(f.Type, name, env, names)
+		} else if env != "" {
+			names[name] = env
+		}
+	}
+	return names
+}
+
+func applyEnv(v reflect.Value, prefix, envPrefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := fieldName(prefix, f)
+		env := envName(envPrefix, f)
+		if isNested(f.Type) {
+			if err := applyEnv(v.Field(i), name, env); err != nil {
+				return err
+			}
+			continue
+		}
+		if env == "" {
+			continue
+		}
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return &FieldError{Field: name, Env: env, Msg: fmt.Sprintf("cannot parse %q: %v", value, err)}
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Pointer {
+		elem := reflect.New(field.Type().Elem())
+		if err := setField(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+	if field.Addr().Type().Implements(textUnmarshalerType) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+func fieldName(prefix string, f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("toml"), ",")[0]
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
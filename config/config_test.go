@@ -0,0 +1,606 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	diffchecker "erinaceus_data_feeds/diffChecker"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validTOML = `
+[node]
+url = "wss://example.org"
+chain_id = 4090
+
+[feed]
+address = "0x46C35E26653eB21A474E74887a9CFB0e61620175"
+log_poll_interval = "10s"
+threshold = 1.5
+
+[feed.source]
+url = "http://localhost:8080/price"
+json_path = "ripple.usd"
+
+[keys]
+password = "secret"
+`
+
+const validYAML = `
+node:
+  url: wss://example.org
+  chain_id: 4090
+feed:
+  address: "0x46C35E26653eB21A474E74887a9CFB0e61620175"
+  idle_timer:
+    period: 5m
+  source:
+    url: http://localhost:8080/price
+    json_path: ripple.usd
+keys:
+  password: secret
+log:
+  format: text
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadTOML(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+
+	assert.Equal(t, "wss://example.org", cfg.Node.URL)
+	assert.Equal(t, common.HexToAddress("0x46C35E26653eB21A474E74887a9CFB0e61620175"), cfg.Feed.ContractAddress())
+	assert.Equal(t, 10*time.Second, cfg.Feed.LogPollInterval.D())
+	assert.Equal(t, 2*time.Minute, cfg.Feed.IdleTimer.Period.D())
+	assert.Equal(t, 1.5, cfg.Feed.Threshold)
+	assert.Equal(t, "ftn_key.json", cfg.Keys.JSONPath)
+	assert.Equal(t, "info", cfg.Log.Level)
+}
+
+func TestLoadYAML(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.yaml", validYAML))
+	require.NoError(t, err)
+
+	assert.Equal(t, 5*time.Minute, cfg.Feed.IdleTimer.Period.D())
+	assert.Equal(t, 30*time.Second, cfg.Feed.LogPollInterval.D())
+	assert.Equal(t, "text", cfg.Log.Format)
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	t.Setenv("EC_NODE_URL", "wss://override.org")
+	t.Setenv("EC_CHAIN_ID", "1")
+	t.Setenv("EC_LOG_POLL_INTERVAL", "1m")
+	t.Setenv("EC_IDLE_TIMER_PERIOD", "1h")
+	t.Setenv("EC_DRUMBEAT_ENABLED", "true")
+	t.Setenv("EC_DRUMBEAT_SCHEDULE", "@every 10m")
+	t.Setenv("EC_MIN_PAYMENT", "1000000000000000000")
+	t.Setenv("EC_API_HEADER_NAME", "x-api-key")
+	t.Setenv("EC_API_KEY", "key")
+
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+
+	assert.Equal(t, "wss://override.org", cfg.Node.URL)
+	assert.Equal(t, int64(1), cfg.Node.ChainID)
+	assert.Equal(t, time.Minute, cfg.Feed.LogPollInterval.D())
+	assert.Equal(t, time.Hour, cfg.Feed.IdleTimer.Period.D())
+	assert.True(t, cfg.Feed.Drumbeat.Enabled)
+	assert.Equal(t, "1000000000000000000", cfg.Feed.MinContractPayment().String())
+	assert.Equal(t, map[string]string{"x-api-key": "key"}, cfg.Feed.Source.Headers())
+}
+
+func TestLoadEnvOnly(t *testing.T) {
+	t.Setenv("EC_NODE_URL", "wss://example.org")
+	t.Setenv("EC_FEED_ADDRESS", "0x46c35e26653eb21a474e74887a9cfb0e61620175")
+	t.Setenv("EC_API_URL", "http://localhost:8080/price")
+	t.Setenv("EC_API_JSON_PATH", "ripple.usd")
+	t.Setenv("EC_FTN_KEY_PASSWORD", "secret")
+
+	_, err := Load("")
+	require.NoError(t, err)
+}
+
+func TestLoadInvalidDrumbeatSchedule(t *testing.T) {
+	t.Setenv("EC_DRUMBEAT_ENABLED", "true")
+	t.Setenv("EC_DRUMBEAT_SCHEDULE", "hourly")
+
+	_, err := Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.drumbeat.schedule (EC_DRUMBEAT_SCHEDULE)")
+}
+
+func TestLoadInvalidEnvValue(t *testing.T) {
+	t.Setenv("EC_CHAIN_ID", "forty")
+
+	_, err := Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "node.chain_id (EC_CHAIN_ID)")
+}
+
+func TestLoadUnknownField(t *testing.T) {
+	_, err := Load(writeFile(t, "config.toml", validTOML+"\n[extra]\nfoo = 1\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "extra")
+}
+
+func TestValidateFeedAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		errMsg  string
+	}{
+		{"missing", "", "must be set"},
+		{"typo", "0x46C35E26653eB21A474E74887a9CFB0e6162017G", "not a hex encoded address"},
+		{"short", "0x46C35E26653eB21A474E74887a9CFB0e616201", "not a hex encoded address"},
+		{"zero", "0x0000000000000000000000000000000000000000", "zero address"},
+		{"bad checksum", "0x46c35E26653eB21A474E74887a9CFB0e61620175", "invalid EIP55 checksum"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("EC_FEED_ADDRESS", tc.address)
+			_, err := Load(writeFile(t, "config.toml", validTOML))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "feed.address (EC_FEED_ADDRESS)")
+			assert.Contains(t, err.Error(), tc.errMsg)
+		})
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Defaults()
+	cfg.Log.Level = "loud"
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	for _, field := range []string{"node.url", "feed.address", "feed.source.url", "feed.source.json_path", "keys.password", "log.level"} {
+		assert.Contains(t, err.Error(), field)
+	}
+}
+
+const feedsTOML = `
+[node]
+url = "wss://example.org"
+
+[[feeds]]
+name = "XRP/USD"
+address = "0x46C35E26653eB21A474E74887a9CFB0e61620175"
+threshold = 1
+[feeds.source]
+url = "http://localhost:8080/xrp"
+json_path = "ripple.usd"
+
+[[feeds]]
+name = "FTN/USD"
+address = "0x2c84182973e0FBbF5887627A1CdAAA7A643dd10f"
+[feeds.source]
+url = "http://localhost:8080/ftn"
+json_path = "ftn.usd"
+
+[keys]
+password = "secret"
+`
+
+func TestLoadFeeds(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.toml", feedsTOML))
+	require.NoError(t, err)
+
+	feeds := cfg.AllFeeds()
+	require.Len(t, feeds, 2)
+	assert.Equal(t, "XRP/USD", feeds[0].Name)
+	assert.Equal(t, 1.0, feeds[0].Threshold)
+	assert.Equal(t, "FTN/USD", feeds[1].Name)
+	assert.Equal(t, 0.5, feeds[1].Threshold)
+	assert.Equal(t, 30*time.Second, feeds[1].LogPollInterval.D())
+}
+
+func TestLoadFeedsDuplicates(t *testing.T) {
+	dup := feedsTOML + `
+[[feeds]]
+name = "XRP/USD"
+address = "0x46C35E26653eB21A474E74887a9CFB0e61620175"
+[feeds.source]
+url = "http://localhost:8080/xrp"
+json_path = "ripple.usd"
+`
+	_, err := Load(writeFile(t, "config.toml", dup))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `feeds[2].name: duplicate feed name "XRP/USD"`)
+	assert.Contains(t, err.Error(), "feeds[2].address: duplicate feed address")
+}
+
+func TestLoadSingleFeedDefaultName(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+
+	feeds := cfg.AllFeeds()
+	require.Len(t, feeds, 1)
+	assert.Equal(t, "default", feeds[0].Name)
+}
+
+func TestLoadFeedSources(t *testing.T) {
+	content := validTOML + `
+[[feed.sources]]
+name = "coingecko"
+url = "https://api.coingecko.com/api/v3/simple/price?ids=ripple&vs_currencies=usd"
+json_path = "ripple.usd"
+timeout = "2s"
+
+[[feed.sources]]
+url = "https://min-api.cryptocompare.com/data/price?fsym=XRP&tsyms=USD"
+json_path = "USD"
+`
+	cfg, err := Load(writeFile(t, "config.toml", content))
+	require.NoError(t, err)
+
+	sources := cfg.Feed.AllSources()
+	require.Len(t, sources, 2)
+	assert.Equal(t, "coingecko", sources[0].Name)
+	assert.Equal(t, 2*time.Second, sources[0].Timeout.D())
+	assert.Equal(t, "min-api.cryptocompare.com", sources[1].Name)
+	assert.Equal(t, DefaultSourceTimeout, sources[1].Timeout.D())
+	assert.Equal(t, 2, cfg.Feed.MinResponses())
+}
+
+func TestLoadFeedSourcesInvalidQuorum(t *testing.T) {
+	t.Setenv("EC_QUORUM", "3")
+	content := validTOML + `
+[[feed.sources]]
+url = "https://a.example.org"
+json_path = "p"
+
+[[feed.sources]]
+url = "https://b.example.org"
+`
+	_, err := Load(writeFile(t, "config.toml", content))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.quorum (EC_QUORUM): must be 0 (majority) or between 1 and the number of sources (2), got 3")
+	assert.Contains(t, err.Error(), "feed.sources[1].json_path")
+}
+
+func TestLoadOutliers(t *testing.T) {
+	t.Setenv("EC_OUTLIERS_METHOD", "mad")
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, OutlierMAD, cfg.Feed.Outliers.Method)
+	assert.Equal(t, 3.0, cfg.Feed.Outliers.MADMultiplier)
+
+	t.Setenv("EC_OUTLIERS_METHOD", "trimmed_mean")
+	t.Setenv("EC_OUTLIERS_TRIM_FRACTION", "0.5")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.outliers.trim_fraction (EC_OUTLIERS_TRIM_FRACTION)")
+
+	t.Setenv("EC_OUTLIERS_METHOD", "average")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.outliers.method (EC_OUTLIERS_METHOD)")
+}
+
+func TestValidateSourceTypes(t *testing.T) {
+	content := validTOML + `
+[[feed.sources]]
+type = "static"
+value = "n/a"
+
+[[feed.sources]]
+type = "file"
+
+[[feed.sources]]
+type = "aggregator"
+address = "0x1"
+
+[[feed.sources]]
+type = "http_post"
+url = "https://a.example.org"
+json_path = "p"
+
+[[feed.sources]]
+type = "custom"
+params = { pair = "XRP/USD" }
+`
+	_, err := Load(writeFile(t, "config.toml", content))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.sources[0].value")
+	assert.Contains(t, err.Error(), "feed.sources[1].path")
+	assert.Contains(t, err.Error(), "feed.sources[2].address")
+	assert.Contains(t, err.Error(), "feed.sources[3].body")
+	assert.NotContains(t, err.Error(), "feed.sources[4]")
+}
+
+func TestValidateSourceAuth(t *testing.T) {
+	t.Setenv("EC_API_AUTH_TYPE", "query")
+	_, err := Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.source.auth.name (EC_API_AUTH_NAME)")
+	assert.Contains(t, err.Error(), "feed.source.auth.key (EC_API_AUTH_KEY)")
+
+	t.Setenv("EC_API_AUTH_TYPE", "hmac")
+	t.Setenv("EC_API_AUTH_SECRET", "s3cr3t")
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, "X-Signature", cfg.Feed.Source.Auth.SignatureHeader)
+	assert.Equal(t, []string{"s3cr3t"}, cfg.Feed.Secrets())
+}
+
+func TestExampleConfigIsValid(t *testing.T) {
+	t.Setenv("EC_FTN_KEY_PASSWORD", "secret")
+	_, err := Load("../config.example.toml")
+	require.NoError(t, err)
+}
+
+func TestLoadHTTP(t *testing.T) {
+	t.Setenv("EC_HTTP_RETRIES", "5")
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, 5, cfg.HTTP.Retries)
+	assert.Equal(t, 5*time.Second, cfg.HTTP.RequestTimeout.D())
+
+	t.Setenv("EC_HTTP_PROXY", "not a url")
+	t.Setenv("EC_HTTP_CERT_FILE", "client.pem")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "http.proxy (EC_HTTP_PROXY)")
+	assert.Contains(t, err.Error(), "http.key_file (EC_HTTP_KEY_FILE)")
+}
+
+func TestValidateDerivedSource(t *testing.T) {
+	content := validTOML + `
+[[feed.sources]]
+type = "derived"
+name = "xrp_ftn"
+
+[[feed.sources.numerator]]
+url = "https://a.example.org"
+
+[[feed.sources]]
+type = "derived"
+name = "single"
+
+[[feed.sources.numerator]]
+type = "static"
+value = "1"
+`
+	_, err := Load(writeFile(t, "config.toml", content))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.sources[0].numerator[0].json_path")
+	assert.Contains(t, err.Error(), "feed.sources[1].denominator")
+}
+
+func TestLoadSampling(t *testing.T) {
+	t.Setenv("EC_SAMPLING_MODE", "twap")
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, Sampling{Mode: SamplingTWAP, Interval: Duration(10 * time.Second), Window: Duration(5 * time.Minute), MinSamples: 3}, cfg.Feed.Sampling)
+
+	t.Setenv("EC_SAMPLING_MODE", "vwap")
+	t.Setenv("EC_SAMPLING_WINDOW", "5s")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.sampling.window (EC_SAMPLING_WINDOW)")
+	assert.Contains(t, err.Error(), "vwap needs a volume_json_path")
+}
+
+func TestValidateMaxAgeNeedsTimestamp(t *testing.T) {
+	t.Setenv("EC_API_MAX_AGE", "1m")
+	_, err := Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.source.timestamp_json_path (EC_API_TIMESTAMP_JSON_PATH)")
+
+	t.Setenv("EC_API_TIMESTAMP_JSON_PATH", "ripple.last_updated_at")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+}
+
+func TestLoadCircuitBreaker(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, CircuitBreaker{FailureThreshold: 5, Cooldown: Duration(time.Minute)}, cfg.Feed.CircuitBreaker)
+	assert.Equal(t, Duration(time.Minute), cfg.Log.StatusInterval)
+
+	t.Setenv("EC_CIRCUIT_BREAKER_FAILURE_THRESHOLD", "-1")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.circuit_breaker.failure_threshold (EC_CIRCUIT_BREAKER_FAILURE_THRESHOLD)")
+}
+
+func TestValidateRateLimits(t *testing.T) {
+	content := validTOML + `
+[[http.rate_limits]]
+host = "api.coingecko.com"
+requests_per_second = 0.5
+
+[[http.rate_limits]]
+host = "https://api.example.org/"
+api_key = "secret"
+requests_per_second = 0
+`
+	_, err := Load(writeFile(t, "config.toml", content))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "http.rate_limits[1].host")
+	assert.Contains(t, err.Error(), "http.rate_limits[1].requests_per_second")
+	assert.NotContains(t, err.Error(), "http.rate_limits[0]")
+}
+
+func TestLoadThresholds(t *testing.T) {
+	t.Setenv("EC_THRESHOLD", "25")
+	t.Setenv("EC_THRESHOLD_UNIT", "bps")
+	t.Setenv("EC_THRESHOLD_MODE", "or")
+	t.Setenv("EC_ABSOLUTE_THRESHOLD", "100")
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, diffchecker.Thresholds{Relative: 0.25, Absolute: 100, Mode: diffchecker.ModeOr}, cfg.Feed.Thresholds())
+
+	t.Setenv("EC_THRESHOLD", "20000")
+	t.Setenv("EC_THRESHOLD_MODE", "xor")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.threshold (EC_THRESHOLD): must be between 0 and 10000 basis points")
+	assert.Contains(t, err.Error(), "feed.threshold_mode (EC_THRESHOLD_MODE)")
+}
+
+func TestLoadIdleTimerMode(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, IdleTimerFixed, cfg.Feed.IdleTimer.Mode)
+
+	t.Setenv("EC_IDLE_TIMER_MODE", "round_age")
+	t.Setenv("EC_IDLE_TIMER_RANDOM_DELAY", "5s")
+	cfg, err = Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, IdleTimer{Period: Duration(2 * time.Minute), Mode: IdleTimerRoundAge, RandomDelay: Duration(5 * time.Second)}, cfg.Feed.IdleTimer)
+
+	t.Setenv("EC_IDLE_TIMER_MODE", "chain")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.idle_timer.mode (EC_IDLE_TIMER_MODE)")
+}
+
+func TestLoadMarketHours(t *testing.T) {
+	t.Setenv("EC_DRUMBEAT_ENABLED", "true")
+	t.Setenv("EC_DRUMBEAT_SCHEDULE", "0 * * * mon-fri")
+	t.Setenv("EC_DRUMBEAT_TIMEZONE", "America/New_York")
+	t.Setenv("EC_MARKET_HOURS_ENABLED", "true")
+	t.Setenv("EC_MARKET_HOURS_TIMEZONE", "America/New_York")
+	t.Setenv("EC_MARKET_HOURS_OPEN", "09:30")
+	t.Setenv("EC_MARKET_HOURS_CLOSE", "16:00")
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, "mon-fri", cfg.Feed.MarketHours.Days)
+	calendar, err := cfg.Feed.MarketHours.Calendar()
+	require.NoError(t, err)
+	assert.True(t, calendar.IsOpen(time.Date(2026, 3, 2, 15, 0, 0, 0, time.UTC)))
+	schedule, err := cfg.Feed.Drumbeat.Parse()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 2, 15, 0, 0, 0, time.UTC), schedule.Next(time.Date(2026, 3, 2, 14, 30, 0, 0, time.UTC)).UTC())
+
+	t.Setenv("EC_DRUMBEAT_TIMEZONE", "Mars/Olympus")
+	t.Setenv("EC_MARKET_HOURS_CLOSE", "09:30")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.drumbeat.timezone (EC_DRUMBEAT_TIMEZONE): unknown time zone Mars/Olympus")
+	assert.Contains(t, err.Error(), "feed.market_hours: opening and closing times must differ")
+}
+
+func TestLoadHysteresis(t *testing.T) {
+	t.Setenv("EC_HYSTERESIS_OBSERVATIONS", "3")
+	t.Setenv("EC_HYSTERESIS_SUSTAIN", "1m")
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, &diffchecker.Hysteresis{Observations: 3, Sustain: time.Minute}, cfg.Feed.Hysteresis.Checker())
+
+	t.Setenv("EC_HYSTERESIS_OBSERVATIONS", "-1")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.hysteresis.observations (EC_HYSTERESIS_OBSERVATIONS): must not be negative")
+}
+
+func TestLoadGuardrails(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, Guardrails{}, cfg.Feed.Guardrails, "unset")
+
+	cfg, err = Load(writeFile(t, "config.toml", validTOML+`
+[feed.guardrails]
+min_price = "0"
+max_price = "0.000000000123456789"
+`))
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Feed.Guardrails.MinPrice, "zero is an explicit bound")
+	assert.True(t, cfg.Feed.Guardrails.MinPrice.IsZero())
+	assert.Equal(t, "0.000000000123456789", cfg.Feed.Guardrails.MaxPrice.String())
+
+	t.Setenv("EC_GUARDRAILS_MIN_PRICE", "0.1")
+	t.Setenv("EC_GUARDRAILS_MAX_PRICE", "10")
+	t.Setenv("EC_GUARDRAILS_MAX_JUMP", "25")
+	t.Setenv("EC_GUARDRAILS_OVERRIDE_UNTIL", "2026-03-02T18:00:00Z")
+	t.Setenv("EC_GUARDRAILS_OVERRIDE_FILE", "/run/feed/override")
+	cfg, err = Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	guardrails := cfg.Feed.Guardrails
+	assert.Equal(t, "0.1", guardrails.MinPrice.String())
+	assert.Equal(t, "10", guardrails.MaxPrice.String())
+	assert.Equal(t, "25", guardrails.MaxJump.String())
+	assert.Equal(t, time.Date(2026, 3, 2, 18, 0, 0, 0, time.UTC), guardrails.OverrideUntil)
+	assert.Equal(t, "/run/feed/override", guardrails.OverrideFile)
+
+	t.Setenv("EC_GUARDRAILS_MAX_PRICE", "0.05")
+	t.Setenv("EC_GUARDRAILS_MAX_JUMP", "0")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.guardrails.max_price (EC_GUARDRAILS_MAX_PRICE): must be above min_price 0.1")
+	assert.Contains(t, err.Error(), "feed.guardrails.max_jump (EC_GUARDRAILS_MAX_JUMP): must be positive")
+
+	t.Setenv("EC_GUARDRAILS_MAX_PRICE", "ten")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `feed.guardrails.max_price (EC_GUARDRAILS_MAX_PRICE): cannot parse "ten"`)
+}
+
+func TestLoadProfitability(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, Profitability{PaymentRate: 1}, cfg.Feed.Profitability)
+
+	t.Setenv("EC_PROFITABILITY_ENABLED", "true")
+	t.Setenv("EC_PROFITABILITY_PAYMENT_RATE", "0.5")
+	t.Setenv("EC_PROFITABILITY_ALWAYS_SUBMIT_DEVIATIONS", "true")
+	cfg, err = Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, Profitability{Enabled: true, PaymentRate: 0.5, AlwaysSubmitDeviations: true}, cfg.Feed.Profitability)
+
+	t.Setenv("EC_PROFITABILITY_PAYMENT_RATE", "-1")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "feed.profitability.payment_rate (EC_PROFITABILITY_PAYMENT_RATE): must be positive")
+}
+
+func TestLoadWithdrawal(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.False(t, cfg.Withdrawal.Enabled)
+	assert.Equal(t, time.Hour, cfg.Withdrawal.Interval.D())
+
+	t.Setenv("EC_WITHDRAWAL_ENABLED", "true")
+	t.Setenv("EC_WITHDRAWAL_THRESHOLD", "1000000000000000000")
+	t.Setenv("EC_WITHDRAWAL_PAYEE", "0x46c35e26653eb21a474e74887a9cfb0e61620175")
+	cfg, err = Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, "1000000000000000000", cfg.Withdrawal.Threshold.String())
+	assert.Equal(t, "withdrawals.jsonl", cfg.Withdrawal.JournalPath)
+
+	t.Setenv("EC_WITHDRAWAL_INTERVAL", "0s")
+	t.Setenv("EC_WITHDRAWAL_PAYEE", "bob")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "withdrawal.interval (EC_WITHDRAWAL_INTERVAL): must be positive")
+	assert.Contains(t, err.Error(), `withdrawal.payee (EC_WITHDRAWAL_PAYEE): "bob" is not a hex encoded address`)
+}
+
+func TestLoadTxManager(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), cfg.TxManager.BumpAfterBlocks)
+	assert.Equal(t, uint64(20), cfg.TxManager.BumpPercent)
+	assert.Equal(t, 2*time.Second, cfg.TxManager.PollInterval.D())
+
+	t.Setenv("EC_TX_MAX_GAS_PRICE", "50000000000")
+	cfg, err = Load(writeFile(t, "config.toml", validTOML))
+	require.NoError(t, err)
+	assert.Equal(t, "50000000000", cfg.TxManager.MaxGasPrice.String())
+
+	t.Setenv("EC_TX_BUMP_PERCENT", "5")
+	_, err = Load(writeFile(t, "config.toml", validTOML))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tx_manager.bump_percent (EC_TX_BUMP_PERCENT): must be at least 10, got 5")
+}
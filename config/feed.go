@@ -0,0 +1,830 @@
+package config
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	diffchecker "erinaceus_data_feeds/diffChecker"
+	ubig "erinaceus_data_feeds/utils/big"
+	"erinaceus_data_feeds/utils/scale"
+	"erinaceus_data_feeds/utils/schedule"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"go.uber.org/multierr"
+)
+
+// Feed describes the aggregator contract we answer rounds for, when we answer
+// them and where the price comes from. It mirrors the fields of a Chainlink
+// flux monitor job.
+type Feed struct {
+	// Name tags every log line of the feed.
+	Name            string   `toml:"name" yaml:"name" env:"EC_FEED_NAME"`
+	Address         string   `toml:"address" yaml:"address" env:"EC_FEED_ADDRESS"`
+	ReplayFromBlock uint64   `toml:"replay_from_block" yaml:"replay_from_block" env:"EC_REPLAY_FROM_BLOCK"`
+	LogPollInterval Duration `toml:"log_poll_interval" yaml:"log_poll_interval" env:"EC_LOG_POLL_INTERVAL"`
+	// Threshold is the relative deviation that triggers a new submission, in
+	// ThresholdUnit.
+	Threshold float64 `toml:"threshold" yaml:"threshold" env:"EC_THRESHOLD"`
+	// ThresholdUnit is percent or bps for basis points. It defaults to
+	// percent.
+	ThresholdUnit string `toml:"threshold_unit" yaml:"threshold_unit" env:"EC_THRESHOLD_UNIT"`
+	// AbsoluteThreshold is the absolute change, in submitted units, that
+	// triggers a new submission.
+	AbsoluteThreshold float64 `toml:"absolute_threshold" yaml:"absolute_threshold" env:"EC_ABSOLUTE_THRESHOLD"`
+	// ThresholdMode is and when both set thresholds must be exceeded, as in
+	// the Chainlink flux monitor, or or when either is enough. It defaults to
+	// and.
+	ThresholdMode string `toml:"threshold_mode" yaml:"threshold_mode" env:"EC_THRESHOLD_MODE"`
+	// Hysteresis holds deviations found by the poll timer back until they
+	// persist.
+	Hysteresis Hysteresis `toml:"hysteresis" yaml:"hysteresis" env:"EC_HYSTERESIS"`
+	// PollTimer fetches the price and submits it when it deviates from the
+	// on-chain answer.
+	PollTimer Timer `toml:"poll_timer" yaml:"poll_timer" env:"EC_POLL_TIMER"`
+	// IdleTimer submits the price when no round was answered for a period.
+	IdleTimer IdleTimer `toml:"idle_timer" yaml:"idle_timer" env:"EC_IDLE_TIMER"`
+	Drumbeat  Drumbeat  `toml:"drumbeat" yaml:"drumbeat" env:"EC_DRUMBEAT"`
+	// MarketHours restricts submissions to the trading sessions of the
+	// market the feed tracks.
+	MarketHours MarketHours `toml:"market_hours" yaml:"market_hours" env:"EC_MARKET_HOURS"`
+	// Decimals overrides the aggregator's Decimals() when scaling prices into
+	// submitted answers.
+	Decimals *uint8 `toml:"decimals" yaml:"decimals" env:"EC_DECIMALS"`
+	// Rounding is the rounding mode applied when scaling prices, see
+	// scale.ParseRoundingMode.
+	Rounding string `toml:"rounding" yaml:"rounding" env:"EC_ROUNDING"`
+	// Guardrails block implausible answers instead of submitting them.
+	Guardrails Guardrails `toml:"guardrails" yaml:"guardrails" env:"EC_GUARDRAILS"`
+	// MinPayment is the smallest round payment, in wei, worth submitting for.
+	MinPayment ubig.Big `toml:"min_payment" yaml:"min_payment" env:"EC_MIN_PAYMENT"`
+	// Profitability defers submissions costing more gas than the round pays.
+	Profitability Profitability `toml:"profitability" yaml:"profitability" env:"EC_PROFITABILITY"`
+	// Source is the price API of a feed with a single source. It is ignored
+	// when Sources is set.
+	Source  Source   `toml:"source" yaml:"source"`
+	Sources []Source `toml:"sources" yaml:"sources"`
+	// Quorum is the number of sources that must answer an observation. Zero
+	// means a majority of the sources.
+	Quorum int `toml:"quorum" yaml:"quorum" env:"EC_QUORUM"`
+	// ObservationSource is a task pipeline producing the price, in the DOT-like
+	// syntax of Chainlink observation sources. When set it replaces the
+	// aggregation of the sources, which its source tasks may read by name,
+	// and Source is ignored.
+	ObservationSource string `toml:"observation_source" yaml:"observation_source" env:"EC_OBSERVATION_SOURCE"`
+	// Outliers removes deviating sources before their prices are aggregated.
+	Outliers OutlierFilter `toml:"outliers" yaml:"outliers" env:"EC_OUTLIERS"`
+	// Sampling replaces the spot price of every source with an average over
+	// a rolling window of samples.
+	Sampling Sampling `toml:"sampling" yaml:"sampling" env:"EC_SAMPLING"`
+	// CircuitBreaker stops fetching sources that keep failing.
+	CircuitBreaker CircuitBreaker `toml:"circuit_breaker" yaml:"circuit_breaker" env:"EC_CIRCUIT_BREAKER"`
+}
+
+// CircuitBreaker opens after FailureThreshold consecutive failures of a
+// source, which is then skipped for Cooldown before a single probe fetch
+// decides whether it closes again.
+type CircuitBreaker struct {
+	Disabled         bool     `toml:"disabled" yaml:"disabled" env:"DISABLED"`
+	FailureThreshold int      `toml:"failure_threshold" yaml:"failure_threshold" env:"FAILURE_THRESHOLD"`
+	Cooldown         Duration `toml:"cooldown" yaml:"cooldown" env:"COOLDOWN"`
+}
+
+func (c CircuitBreaker) validate(prefix string) (err error) {
+	if c.Disabled {
+		return nil
+	}
+	if c.FailureThreshold < 1 {
+		err = multierr.Append(err, invalid(prefix+".failure_threshold", "must be at least 1, got %d", c.FailureThreshold))
+	}
+	if c.Cooldown <= 0 {
+		err = multierr.Append(err, invalid(prefix+".cooldown", "must be positive, got %s", c.Cooldown))
+	}
+	return err
+}
+
+// Hysteresis requires a deviation to be seen by Observations consecutive
+// polls and to last for Sustain before it is submitted. Zero values submit the
+// first deviating poll.
+type Hysteresis struct {
+	Observations int      `toml:"observations" yaml:"observations" env:"OBSERVATIONS"`
+	Sustain      Duration `toml:"sustain" yaml:"sustain" env:"SUSTAIN"`
+}
+
+// Checker returns a new hysteresis state for the feed.
+func (h Hysteresis) Checker() *diffchecker.Hysteresis {
+	return &diffchecker.Hysteresis{Observations: h.Observations, Sustain: h.Sustain.D()}
+}
+
+// Guardrails are the plausible answers of a feed, on top of the
+// MinSubmissionValue and MaxSubmissionValue of the aggregator. Answers
+// outside of them are blocked and alerted on.
+type Guardrails struct {
+	// MinPrice is the lowest plausible price, a decimal string. When unset
+	// any positive price is plausible.
+	MinPrice *decimal.Decimal `toml:"min_price" yaml:"min_price" env:"MIN_PRICE"`
+	// MaxPrice is the highest plausible price, unbounded when unset.
+	MaxPrice *decimal.Decimal `toml:"max_price" yaml:"max_price" env:"MAX_PRICE"`
+	// MaxJump is the largest change from the on-chain answer, in percent,
+	// unbounded when unset.
+	MaxJump *decimal.Decimal `toml:"max_jump" yaml:"max_jump" env:"MAX_JUMP"`
+	// OverrideUntil lets answers jumping more than MaxJump through until
+	// then, for an operator to accept a legitimate big move.
+	OverrideUntil time.Time `toml:"override_until" yaml:"override_until" env:"OVERRIDE_UNTIL"`
+	// OverrideFile holds an RFC 3339 time acting as OverrideUntil. It is read
+	// on every check, so that an override needs no restart.
+	OverrideFile string `toml:"override_file" yaml:"override_file" env:"OVERRIDE_FILE"`
+}
+
+func (g Guardrails) validate(prefix string) (err error) {
+	switch {
+	case g.MaxPrice == nil:
+	case g.MinPrice != nil && !g.MaxPrice.GreaterThan(*g.MinPrice):
+		err = multierr.Append(err, invalid(prefix+".max_price", "must be above min_price %s, got %s", g.MinPrice, g.MaxPrice))
+	case g.MinPrice == nil && g.MaxPrice.Sign() <= 0:
+		err = multierr.Append(err, invalid(prefix+".max_price", "must be positive without min_price, got %s", g.MaxPrice))
+	}
+	if g.MaxJump != nil && g.MaxJump.Sign() <= 0 {
+		err = multierr.Append(err, invalid(prefix+".max_jump", "must be positive, got %s", g.MaxJump))
+	}
+	return err
+}
+
+// Profitability compares the estimated gas cost of a submission with the
+// round payment. Unprofitable idle timer and drumbeat submissions are
+// deferred to their next activation.
+type Profitability struct {
+	Enabled bool `toml:"enabled" yaml:"enabled" env:"ENABLED"`
+	// PaymentRate is the wei of native currency one unit of round payment is
+	// worth. It defaults to 1, for payments in the native currency.
+	PaymentRate float64 `toml:"payment_rate" yaml:"payment_rate" env:"PAYMENT_RATE"`
+	// AlwaysSubmitDeviations lets deviation triggered submissions, and
+	// answers to rounds started by other oracles, through when unprofitable.
+	AlwaysSubmitDeviations bool `toml:"always_submit_deviations" yaml:"always_submit_deviations" env:"ALWAYS_SUBMIT_DEVIATIONS"`
+}
+
+// Units of the relative threshold.
+const (
+	ThresholdPercent     = "percent"
+	ThresholdBasisPoints = "bps"
+)
+
+// Sampling modes.
+const (
+	SamplingNone = "none"
+	SamplingTWAP = "twap"
+	SamplingVWAP = "vwap"
+)
+
+// Sampling configures the rolling window each source is sampled into.
+type Sampling struct {
+	// Mode is none, twap for the time-weighted average price or vwap for the
+	// volume-weighted one, which needs sources reporting volume.
+	Mode string `toml:"mode" yaml:"mode" env:"MODE"`
+	// Interval is the time between two samples of a source.
+	Interval Duration `toml:"interval" yaml:"interval" env:"INTERVAL"`
+	// Window is how long a sample is kept.
+	Window Duration `toml:"window" yaml:"window" env:"WINDOW"`
+	// MinSamples is the number of samples the window must hold for the
+	// source to answer.
+	MinSamples int `toml:"min_samples" yaml:"min_samples" env:"MIN_SAMPLES"`
+}
+
+// Enabled reports whether sources are sampled.
+func (s Sampling) Enabled() bool {
+	return s.Mode == SamplingTWAP || s.Mode == SamplingVWAP
+}
+
+func (s Sampling) validate(prefix string, sources []Source) (err error) {
+	switch s.Mode {
+	case "", SamplingNone:
+		return nil
+	case SamplingTWAP, SamplingVWAP:
+	default:
+		return invalid(prefix+".mode", "must be one of none, twap or vwap, got %q", s.Mode)
+	}
+	if s.Interval <= 0 {
+		err = multierr.Append(err, invalid(prefix+".interval", "must be positive, got %s", s.Interval))
+	}
+	if s.Window <= s.Interval {
+		err = multierr.Append(err, invalid(prefix+".window", "must be longer than the interval, got %s", s.Window))
+	}
+	if s.MinSamples < 1 {
+		err = multierr.Append(err, invalid(prefix+".min_samples", "must be at least 1, got %d", s.MinSamples))
+	}
+	if s.Mode == SamplingVWAP {
+		for _, source := range sources {
+			if (source.Type == "" || source.Type == SourceHTTP || source.Type == SourceHTTPPost) && source.VolumeJSONPath == "" {
+				err = multierr.Append(err, invalid(prefix+".mode", "vwap needs a volume_json_path on source %s", source.Name))
+			}
+		}
+	}
+	return err
+}
+
+// Outlier filter methods.
+const (
+	OutlierNone         = "none"
+	OutlierMaxDeviation = "max_deviation"
+	OutlierMAD          = "mad"
+	OutlierTrimmedMean  = "trimmed_mean"
+)
+
+// OutlierFilter selects how prices that disagree with the other sources are
+// rejected.
+type OutlierFilter struct {
+	// Method is one of none, max_deviation, mad or trimmed_mean.
+	Method string `toml:"method" yaml:"method" env:"METHOD"`
+	// MaxDeviation is the largest distance from the median, in percent, a
+	// price may have with the max_deviation method.
+	MaxDeviation float64 `toml:"max_deviation" yaml:"max_deviation" env:"MAX_DEVIATION"`
+	// MADMultiplier is the number of median absolute deviations a price may
+	// be away from the median with the mad method.
+	MADMultiplier float64 `toml:"mad_multiplier" yaml:"mad_multiplier" env:"MAD_MULTIPLIER"`
+	// TrimFraction is the share of lowest and of highest prices dropped by
+	// the trimmed_mean method before averaging the rest.
+	TrimFraction float64 `toml:"trim_fraction" yaml:"trim_fraction" env:"TRIM_FRACTION"`
+}
+
+func (o OutlierFilter) validate(prefix string) (err error) {
+	switch o.Method {
+	case "", OutlierNone:
+	case OutlierMaxDeviation:
+		if o.MaxDeviation <= 0 {
+			err = multierr.Append(err, invalid(prefix+".max_deviation", "must be positive, got %v", o.MaxDeviation))
+		}
+	case OutlierMAD:
+		if o.MADMultiplier <= 0 {
+			err = multierr.Append(err, invalid(prefix+".mad_multiplier", "must be positive, got %v", o.MADMultiplier))
+		}
+	case OutlierTrimmedMean:
+		if o.TrimFraction <= 0 || o.TrimFraction >= 0.5 {
+			err = multierr.Append(err, invalid(prefix+".trim_fraction", "must be greater than 0 and less than 0.5, got %v", o.TrimFraction))
+		}
+	default:
+		err = multierr.Append(err, invalid(prefix+".method", "must be one of none, max_deviation, mad or trimmed_mean, got %q", o.Method))
+	}
+	return err
+}
+
+// Timer is a periodic trigger that can be switched off.
+type Timer struct {
+	Period   Duration `toml:"period" yaml:"period" env:"PERIOD"`
+	Disabled bool     `toml:"disabled" yaml:"disabled" env:"DISABLED"`
+}
+
+// Idle timer modes.
+const (
+	IdleTimerFixed    = "fixed"
+	IdleTimerRoundAge = "round_age"
+)
+
+// IdleTimer submits a heartbeat when the feed was not updated for Period.
+type IdleTimer struct {
+	Period   Duration `toml:"period" yaml:"period" env:"PERIOD"`
+	Disabled bool     `toml:"disabled" yaml:"disabled" env:"DISABLED"`
+	// Mode is fixed to fire every Period since this node last submitted, or
+	// round_age to fire once the on-chain answer is older than Period, re-armed
+	// by every AnswerUpdated event. It defaults to fixed.
+	Mode string `toml:"mode" yaml:"mode" env:"MODE"`
+	// RandomDelay spreads the heartbeats of the oracles of a round_age feed,
+	// which all see the same answer age.
+	RandomDelay Duration `toml:"random_delay" yaml:"random_delay" env:"RANDOM_DELAY"`
+}
+
+// Drumbeat starts rounds on a schedule regardless of deviation.
+type Drumbeat struct {
+	Enabled bool `toml:"enabled" yaml:"enabled" env:"ENABLED"`
+	// Schedule is "@every <duration>", a five-field cron expression such as
+	// "0 * * * *" for every hour on the hour, or a descriptor such as @daily.
+	Schedule string `toml:"schedule" yaml:"schedule" env:"SCHEDULE"`
+	// Timezone is the IANA timezone cron schedules are evaluated in. It
+	// defaults to UTC.
+	Timezone    string   `toml:"timezone" yaml:"timezone" env:"TIMEZONE"`
+	RandomDelay Duration `toml:"random_delay" yaml:"random_delay" env:"RANDOM_DELAY"`
+}
+
+// Parse returns the parsed Schedule.
+func (d Drumbeat) Parse() (schedule.Schedule, error) {
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %v", d.Timezone, err)
+	}
+	return schedule.Parse(d.Schedule, loc)
+}
+
+// MarketHours are the trading sessions of a market. Outside of them the
+// drumbeat and idle timer do not fire and deviations are only submitted when
+// DeviationOutsideHours is set.
+type MarketHours struct {
+	Enabled bool `toml:"enabled" yaml:"enabled" env:"ENABLED"`
+	// Timezone is the IANA timezone of the market. It defaults to UTC.
+	Timezone string `toml:"timezone" yaml:"timezone" env:"TIMEZONE"`
+	// Days are the trading days, such as "mon-fri" or "sun-thu". They default
+	// to mon-fri.
+	Days string `toml:"days" yaml:"days" env:"DAYS"`
+	// Open and Close bound the daily session as "15:04", with "24:00" for
+	// midnight. A session closing before it opens ends on the next day. They
+	// default to the whole day.
+	Open  string `toml:"open" yaml:"open" env:"OPEN"`
+	Close string `toml:"close" yaml:"close" env:"CLOSE"`
+	// Holidays are the dates, as "2006-01-02", the market stays closed.
+	Holidays              []string `toml:"holidays" yaml:"holidays"`
+	DeviationOutsideHours bool     `toml:"deviation_outside_hours" yaml:"deviation_outside_hours" env:"DEVIATION_OUTSIDE_HOURS"`
+}
+
+// Calendar returns the trading calendar, nil when market hours are disabled.
+func (m MarketHours) Calendar() (*schedule.Calendar, error) {
+	if !m.Enabled {
+		return nil, nil
+	}
+	return schedule.NewCalendar(m.Timezone, m.Days, m.Open, m.Close, m.Holidays)
+}
+
+// Source types built into the node. Other types name adapters registered with
+// timer.RegisterSource.
+const (
+	SourceHTTP       = "http"
+	SourceHTTPPost   = "http_post"
+	SourceStatic     = "static"
+	SourceFile       = "file"
+	SourceAggregator = "aggregator"
+	SourceDerived    = "derived"
+)
+
+// Source is one price source of a feed, an HTTP JSON API unless Type selects
+// another adapter.
+type Source struct {
+	// Type selects the adapter: http, http_post, static, file, aggregator,
+	// derived or a registered custom type. It defaults to http.
+	Type string `toml:"type" yaml:"type" env:"EC_API_TYPE"`
+	// Name identifies the source in logs. It defaults to the URL host.
+	Name       string `toml:"name" yaml:"name" env:"EC_API_NAME"`
+	URL        string `toml:"url" yaml:"url" env:"EC_API_URL"`
+	HeaderName string `toml:"header_name" yaml:"header_name" env:"EC_API_HEADER_NAME"`
+	APIKey     string `toml:"api_key" yaml:"api_key" env:"EC_API_KEY"`
+	JSONPath   string `toml:"json_path" yaml:"json_path" env:"EC_API_JSON_PATH"`
+	// VolumeJSONPath extracts the traded volume reported with the price,
+	// used by vwap sampling.
+	VolumeJSONPath string `toml:"volume_json_path" yaml:"volume_json_path" env:"EC_API_VOLUME_JSON_PATH"`
+	// TimestampJSONPath extracts the time the price was last updated from the
+	// response of an http source or the content of a file source, as Unix
+	// seconds, Unix milliseconds or an RFC 3339 string.
+	TimestampJSONPath string `toml:"timestamp_json_path" yaml:"timestamp_json_path" env:"EC_API_TIMESTAMP_JSON_PATH"`
+	// Body is the request body of an http_post source.
+	Body string `toml:"body" yaml:"body" env:"EC_API_BODY"`
+	// Value is the fixed price of a static source.
+	Value string `toml:"value" yaml:"value" env:"EC_API_VALUE"`
+	// Path is the file a file source reads, parsed with JSONPath when set.
+	Path string `toml:"path" yaml:"path" env:"EC_API_PATH"`
+	// Address is the aggregator whose latest answer an aggregator source reads.
+	Address string `toml:"address" yaml:"address" env:"EC_API_ADDRESS"`
+	// Auth authenticates the requests of http and http_post sources.
+	Auth Auth `toml:"auth" yaml:"auth" env:"EC_API_AUTH"`
+	// Numerator and Denominator are the inputs of a derived source. Its price
+	// is the product of the numerator prices divided by the product of the
+	// denominator prices, e.g. XRP/FTN from XRP/USD over FTN/USD.
+	Numerator   []Source `toml:"numerator" yaml:"numerator"`
+	Denominator []Source `toml:"denominator" yaml:"denominator"`
+	// MaxAge rejects prices last updated longer ago. A derived source applies
+	// it to those of its inputs that set none. Zero disables the check.
+	MaxAge Duration `toml:"max_age" yaml:"max_age" env:"EC_API_MAX_AGE"`
+	// Params holds the settings of custom adapters.
+	Params map[string]string `toml:"params" yaml:"params"`
+	// Timeout bounds a single request to the source.
+	Timeout Duration `toml:"timeout" yaml:"timeout" env:"EC_API_TIMEOUT"`
+}
+
+// Authentication schemes of HTTP sources.
+const (
+	AuthNone   = "none"
+	AuthHeader = "header"
+	AuthQuery  = "query"
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+	AuthHMAC   = "hmac"
+)
+
+// Auth selects how an HTTP source authenticates its requests.
+type Auth struct {
+	// Type is one of none, header, query, bearer, basic or hmac.
+	Type string `toml:"type" yaml:"type" env:"TYPE"`
+	// Name is the header of the header and hmac schemes, or the query
+	// parameter of the query scheme, carrying Key.
+	Name string `toml:"name" yaml:"name" env:"NAME"`
+	// Key is the API key, or the token of the bearer scheme.
+	Key      string `toml:"key" yaml:"key" env:"KEY"`
+	Username string `toml:"username" yaml:"username" env:"USERNAME"`
+	Password string `toml:"password" yaml:"password" env:"PASSWORD"`
+	// Secret signs hmac requests: the hex HMAC-SHA256 of timestamp, method,
+	// request URI and body.
+	Secret          string `toml:"secret" yaml:"secret" env:"SECRET"`
+	SignatureHeader string `toml:"signature_header" yaml:"signature_header" env:"SIGNATURE_HEADER"`
+	// TimestampHeader carries the millisecond timestamp that makes every
+	// signature unique.
+	TimestampHeader string `toml:"timestamp_header" yaml:"timestamp_header" env:"TIMESTAMP_HEADER"`
+}
+
+func (a Auth) validate(prefix string) (err error) {
+	switch a.Type {
+	case "", AuthNone:
+	case AuthHeader, AuthQuery:
+		if a.Name == "" {
+			err = multierr.Append(err, invalid(prefix+".name", "must be set for %s auth", a.Type))
+		}
+		if a.Key == "" {
+			err = multierr.Append(err, invalid(prefix+".key", "must be set for %s auth", a.Type))
+		}
+	case AuthBearer:
+		if a.Key == "" {
+			err = multierr.Append(err, invalid(prefix+".key", "must be set for bearer auth"))
+		}
+	case AuthBasic:
+		if a.Username == "" {
+			err = multierr.Append(err, invalid(prefix+".username", "must be set for basic auth"))
+		}
+	case AuthHMAC:
+		if a.Secret == "" {
+			err = multierr.Append(err, invalid(prefix+".secret", "must be set for hmac auth"))
+		}
+	default:
+		err = multierr.Append(err, invalid(prefix+".type", "must be one of none, header, query, bearer, basic or hmac, got %q", a.Type))
+	}
+	return err
+}
+
+func (a *Auth) setDefaults() {
+	if a.Type == "" {
+		a.Type = AuthNone
+	}
+	if a.Type != AuthHMAC {
+		return
+	}
+	if a.Name == "" {
+		a.Name = "X-API-Key"
+	}
+	if a.SignatureHeader == "" {
+		a.SignatureHeader = "X-Signature"
+	}
+	if a.TimestampHeader == "" {
+		a.TimestampHeader = "X-Timestamp"
+	}
+}
+
+// Secrets returns the credentials of the source that must never be logged.
+func (s Source) Secrets() []string {
+	var secrets []string
+	for _, secret := range []string{s.APIKey, s.Auth.Key, s.Auth.Password, s.Auth.Secret} {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	for _, input := range s.Inputs() {
+		secrets = append(secrets, input.Secrets()...)
+	}
+	return secrets
+}
+
+// Secrets returns the credentials of every source of the feed.
+func (f Feed) Secrets() []string {
+	var secrets []string
+	for _, source := range f.AllSources() {
+		secrets = append(secrets, source.Secrets()...)
+	}
+	return secrets
+}
+
+// DefaultSourceTimeout is used for sources that do not set a timeout.
+const DefaultSourceTimeout = 10 * time.Second
+
+// AllSources returns the sources of the feed: every entry of Sources, or the
+// single Source when no list and no observation source are configured.
+func (f Feed) AllSources() []Source {
+	if len(f.Sources) > 0 || f.ObservationSource != "" {
+		return f.Sources
+	}
+	return []Source{f.Source}
+}
+
+// MinResponses returns the number of sources that must answer for an
+// observation to be used.
+func (f Feed) MinResponses() int {
+	if f.Quorum > 0 {
+		return f.Quorum
+	}
+	return len(f.AllSources())/2 + 1
+}
+
+// Headers returns the request headers configured for the source.
+func (s Source) Headers() map[string]string {
+	headers := make(map[string]string)
+	if s.HeaderName != "" && s.APIKey != "" {
+		headers[s.HeaderName] = s.APIKey
+	}
+	return headers
+}
+
+// DefaultFeed returns the feed settings applied when a field is left unset.
+func DefaultFeed() Feed {
+	return Feed{
+		Name:            "default",
+		ReplayFromBlock: 1000000,
+		LogPollInterval: Duration(30 * time.Second),
+		Threshold:       0.5,
+		ThresholdUnit:   ThresholdPercent,
+		ThresholdMode:   diffchecker.ModeAnd,
+		PollTimer:       Timer{Period: Duration(30 * time.Second)},
+		IdleTimer:       IdleTimer{Period: Duration(2 * time.Minute), Mode: IdleTimerFixed},
+	}
+}
+
+// ContractAddress returns the aggregator address. Only call it on a validated
+// config.
+func (f Feed) ContractAddress() common.Address {
+	return common.HexToAddress(f.Address)
+}
+
+// RoundingMode returns the parsed Rounding. Only call it on a validated config.
+func (f Feed) RoundingMode() scale.RoundingMode {
+	mode, _ := scale.ParseRoundingMode(f.Rounding)
+	return mode
+}
+
+// Thresholds returns the deviation thresholds of the feed, with the relative
+// one in percent.
+func (f Feed) Thresholds() diffchecker.Thresholds {
+	relative := f.Threshold
+	if f.ThresholdUnit == ThresholdBasisPoints {
+		relative /= 100
+	}
+	return diffchecker.Thresholds{Relative: relative, Absolute: f.AbsoluteThreshold, Mode: f.ThresholdMode}
+}
+
+// MinContractPayment returns MinPayment as a *big.Int.
+func (f Feed) MinContractPayment() *big.Int {
+	return f.MinPayment.ToInt()
+}
+
+// Validate checks every field of the feed, naming them with the given prefix.
+func (f Feed) Validate(prefix string) (err error) {
+	if f.Name == "" {
+		err = multierr.Append(err, invalid(prefix+".name", "must be set"))
+	}
+	err = multierr.Append(err, validateAddress(prefix+".address", f.Address))
+	if f.LogPollInterval <= 0 {
+		err = multierr.Append(err, invalid(prefix+".log_poll_interval", "must be positive, got %s", f.LogPollInterval))
+	}
+	switch f.ThresholdUnit {
+	case ThresholdPercent:
+		if f.Threshold < 0 || f.Threshold > 100 {
+			err = multierr.Append(err, invalid(prefix+".threshold", "must be a percentage between 0 and 100, got %v", f.Threshold))
+		}
+	case ThresholdBasisPoints:
+		if f.Threshold < 0 || f.Threshold > 10000 {
+			err = multierr.Append(err, invalid(prefix+".threshold", "must be between 0 and 10000 basis points, got %v", f.Threshold))
+		}
+	default:
+		err = multierr.Append(err, invalid(prefix+".threshold_unit", "must be percent or bps, got %q", f.ThresholdUnit))
+	}
+	if f.ThresholdMode != diffchecker.ModeAnd && f.ThresholdMode != diffchecker.ModeOr {
+		err = multierr.Append(err, invalid(prefix+".threshold_mode", "must be and or or, got %q", f.ThresholdMode))
+	}
+	if f.AbsoluteThreshold < 0 {
+		err = multierr.Append(err, invalid(prefix+".absolute_threshold", "must not be negative, got %v", f.AbsoluteThreshold))
+	}
+	if f.Hysteresis.Observations < 0 {
+		err = multierr.Append(err, invalid(prefix+".hysteresis.observations", "must not be negative, got %d", f.Hysteresis.Observations))
+	}
+	if f.Hysteresis.Sustain < 0 {
+		err = multierr.Append(err, invalid(prefix+".hysteresis.sustain", "must not be negative, got %s", f.Hysteresis.Sustain))
+	}
+	if !f.PollTimer.Disabled && f.PollTimer.Period <= 0 {
+		err = multierr.Append(err, invalid(prefix+".poll_timer.period", "must be positive, got %s", f.PollTimer.Period))
+	}
+	if !f.IdleTimer.Disabled && f.IdleTimer.Period <= 0 {
+		err = multierr.Append(err, invalid(prefix+".idle_timer.period", "must be positive, got %s", f.IdleTimer.Period))
+	}
+	if f.IdleTimer.Mode != IdleTimerFixed && f.IdleTimer.Mode != IdleTimerRoundAge {
+		err = multierr.Append(err, invalid(prefix+".idle_timer.mode", "must be fixed or round_age, got %q", f.IdleTimer.Mode))
+	}
+	if f.IdleTimer.RandomDelay < 0 {
+		err = multierr.Append(err, invalid(prefix+".idle_timer.random_delay", "must not be negative, got %s", f.IdleTimer.RandomDelay))
+	}
+	if f.PollTimer.Disabled && f.IdleTimer.Disabled && !f.Drumbeat.Enabled {
+		err = multierr.Append(err, invalid(prefix+".poll_timer.disabled", "poll timer, idle timer and drumbeat cannot all be disabled"))
+	}
+	if f.Drumbeat.Enabled {
+		if _, lerr := time.LoadLocation(f.Drumbeat.Timezone); lerr != nil {
+			err = multierr.Append(err, invalid(prefix+".drumbeat.timezone", "%v", lerr))
+		} else if _, serr := f.Drumbeat.Parse(); serr != nil {
+			err = multierr.Append(err, invalid(prefix+".drumbeat.schedule", "%v", serr))
+		}
+	}
+	if f.Drumbeat.RandomDelay < 0 {
+		err = multierr.Append(err, invalid(prefix+".drumbeat.random_delay", "must not be negative, got %s", f.Drumbeat.RandomDelay))
+	}
+	err = multierr.Append(err, f.Guardrails.validate(prefix+".guardrails"))
+	if f.Profitability.PaymentRate <= 0 {
+		err = multierr.Append(err, invalid(prefix+".profitability.payment_rate", "must be positive, got %v", f.Profitability.PaymentRate))
+	}
+	if _, cerr := f.MarketHours.Calendar(); cerr != nil {
+		err = multierr.Append(err, invalid(prefix+".market_hours", "%v", cerr))
+	}
+	if _, rerr := scale.ParseRoundingMode(f.Rounding); rerr != nil {
+		err = multierr.Append(err, invalid(prefix+".rounding", "%v", rerr))
+	}
+	if f.MinContractPayment().Sign() < 0 {
+		err = multierr.Append(err, invalid(prefix+".min_payment", "must not be negative, got %s", f.MinContractPayment()))
+	}
+	sourcesField := prefix + ".source"
+	if len(f.Sources) > 0 {
+		sourcesField = prefix + ".sources"
+	}
+	names := make(map[string]bool)
+	for i, source := range f.AllSources() {
+		field := sourcesField
+		if len(f.Sources) > 0 {
+			field = fmt.Sprintf("%s[%d]", sourcesField, i)
+		}
+		err = multierr.Append(err, source.validate(field))
+		if names[source.Name] {
+			err = multierr.Append(err, invalid(field+".name", "duplicate source name %q", source.Name))
+		}
+		names[source.Name] = true
+	}
+	err = multierr.Append(err, f.Outliers.validate(prefix+".outliers"))
+	err = multierr.Append(err, f.Sampling.validate(prefix+".sampling", f.AllSources()))
+	err = multierr.Append(err, f.CircuitBreaker.validate(prefix+".circuit_breaker"))
+	if f.Quorum < 0 || f.Quorum > len(f.AllSources()) {
+		err = multierr.Append(err, invalid(prefix+".quorum", "must be 0 (majority) or between 1 and the number of sources (%d), got %d", len(f.AllSources()), f.Quorum))
+	}
+	return err
+}
+
+func (s Source) validate(prefix string) (err error) {
+	switch s.Type {
+	case "", SourceHTTP, SourceHTTPPost:
+		if s.URL == "" {
+			err = multierr.Append(err, invalid(prefix+".url", "must be set"))
+		} else if _, perr := url.Parse(s.URL); perr != nil {
+			err = multierr.Append(err, invalid(prefix+".url", "%v", perr))
+		}
+		if s.JSONPath == "" {
+			err = multierr.Append(err, invalid(prefix+".json_path", "must be set"))
+		}
+		if (s.HeaderName == "") != (s.APIKey == "") {
+			err = multierr.Append(err, invalid(prefix+".api_key", "header_name and api_key must be set together"))
+		}
+		err = multierr.Append(err, s.Auth.validate(prefix+".auth"))
+		if s.Type == SourceHTTPPost && s.Body == "" {
+			err = multierr.Append(err, invalid(prefix+".body", "must be set for an http_post source"))
+		}
+		if s.MaxAge > 0 && s.TimestampJSONPath == "" {
+			err = multierr.Append(err, invalid(prefix+".timestamp_json_path", "must be set to check the max_age of an http source"))
+		}
+	case SourceStatic:
+		if _, perr := decimal.NewFromString(s.Value); perr != nil {
+			err = multierr.Append(err, invalid(prefix+".value", "must be a number, got %q", s.Value))
+		}
+	case SourceFile:
+		if s.Path == "" {
+			err = multierr.Append(err, invalid(prefix+".path", "must be set"))
+		}
+	case SourceAggregator:
+		err = multierr.Append(err, validateAddress(prefix+".address", s.Address))
+	case SourceDerived:
+		if len(s.Numerator) == 0 {
+			err = multierr.Append(err, invalid(prefix+".numerator", "must list at least one source"))
+		} else if len(s.Numerator)+len(s.Denominator) < 2 {
+			err = multierr.Append(err, invalid(prefix+".denominator", "a derived source needs at least two inputs"))
+		}
+		for i, input := range s.Numerator {
+			err = multierr.Append(err, input.validate(fmt.Sprintf("%s.numerator[%d]", prefix, i)))
+		}
+		for i, input := range s.Denominator {
+			err = multierr.Append(err, input.validate(fmt.Sprintf("%s.denominator[%d]", prefix, i)))
+		}
+	}
+	if s.MaxAge < 0 {
+		err = multierr.Append(err, invalid(prefix+".max_age", "must not be negative, got %s", s.MaxAge))
+	}
+	if s.Timeout <= 0 {
+		err = multierr.Append(err, invalid(prefix+".timeout", "must be positive, got %s", s.Timeout))
+	}
+	return err
+}
+
+func (s *Source) setDefaults() {
+	if s.Type == "" {
+		s.Type = SourceHTTP
+	}
+	if s.Name == "" {
+		switch {
+		case s.Type == SourceStatic:
+			s.Name = SourceStatic
+		case s.Type == SourceFile:
+			s.Name = s.Path
+		case s.Type == SourceAggregator:
+			s.Name = s.Address
+		case s.URL != "":
+			if u, err := url.Parse(s.URL); err == nil && u.Host != "" {
+				s.Name = u.Host
+			} else {
+				s.Name = s.URL
+			}
+		default:
+			s.Name = s.Type
+		}
+	}
+	if s.Timeout == 0 {
+		s.Timeout = Duration(DefaultSourceTimeout)
+	}
+	s.Auth.setDefaults()
+	for i := range s.Numerator {
+		s.Numerator[i].setDefaults()
+	}
+	for i := range s.Denominator {
+		s.Denominator[i].setDefaults()
+	}
+}
+
+// Inputs returns the numerator and denominator sources of a derived source.
+func (s Source) Inputs() []Source {
+	return append(append([]Source{}, s.Numerator...), s.Denominator...)
+}
+
+// SetDefaults fills the fields of a feed that were left unset.
+func (f *Feed) SetDefaults() {
+	defaults := DefaultFeed()
+	if f.ReplayFromBlock == 0 {
+		f.ReplayFromBlock = defaults.ReplayFromBlock
+	}
+	if f.LogPollInterval == 0 {
+		f.LogPollInterval = defaults.LogPollInterval
+	}
+	if f.ThresholdUnit == "" {
+		f.ThresholdUnit = ThresholdPercent
+	}
+	if f.Threshold == 0 && f.AbsoluteThreshold == 0 {
+		f.Threshold = defaults.Threshold
+		if f.ThresholdUnit == ThresholdBasisPoints {
+			f.Threshold *= 100
+		}
+	}
+	if f.ThresholdMode == "" {
+		f.ThresholdMode = diffchecker.ModeAnd
+	}
+	if f.PollTimer.Period == 0 {
+		f.PollTimer.Period = defaults.PollTimer.Period
+	}
+	if f.IdleTimer.Period == 0 {
+		f.IdleTimer.Period = defaults.IdleTimer.Period
+	}
+	if f.IdleTimer.Mode == "" {
+		f.IdleTimer.Mode = defaults.IdleTimer.Mode
+	}
+	if f.MarketHours.Days == "" {
+		f.MarketHours.Days = "mon-fri"
+	}
+	if f.MarketHours.Open == "" {
+		f.MarketHours.Open = "00:00"
+	}
+	if f.MarketHours.Close == "" {
+		f.MarketHours.Close = "24:00"
+	}
+	if f.Outliers.Method == "" {
+		f.Outliers.Method = OutlierNone
+	}
+	if f.Outliers.Method == OutlierMAD && f.Outliers.MADMultiplier == 0 {
+		f.Outliers.MADMultiplier = 3
+	}
+	if f.Sampling.Mode == "" {
+		f.Sampling.Mode = SamplingNone
+	}
+	if f.Sampling.Enabled() {
+		if f.Sampling.Interval == 0 {
+			f.Sampling.Interval = Duration(10 * time.Second)
+		}
+		if f.Sampling.Window == 0 {
+			f.Sampling.Window = Duration(5 * time.Minute)
+		}
+		if f.Sampling.MinSamples == 0 {
+			f.Sampling.MinSamples = 3
+		}
+	}
+	if f.Profitability.PaymentRate == 0 {
+		f.Profitability.PaymentRate = 1
+	}
+	if f.CircuitBreaker.FailureThreshold == 0 {
+		f.CircuitBreaker.FailureThreshold = 5
+	}
+	if f.CircuitBreaker.Cooldown == 0 {
+		f.CircuitBreaker.Cooldown = Duration(time.Minute)
+	}
+	f.Source.setDefaults()
+	for i := range f.Sources {
+		f.Sources[i].setDefaults()
+	}
+}
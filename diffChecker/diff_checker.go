@@ -1,24 +1,53 @@
 package diffchecker
 
 import (
-	"math/big"
+	"github.com/shopspring/decimal"
 )
 
-func CheckDifference(current, next *big.Int) bool {
-	// Avoid division by zero
-	if current.Sign() == 0 {
-		return false
-	}
+var hundred = decimal.NewFromInt(100)
 
-	// Calculate the difference: diff = (next - current)
-	diff := new(big.Int).Sub(next, current)
+// Ways of combining the relative and absolute thresholds.
+const (
+	// ModeAnd needs every set threshold to be exceeded, as the Chainlink flux
+	// monitor does.
+	ModeAnd = "and"
+	// ModeOr needs any set threshold to be exceeded.
+	ModeOr = "or"
+)
 
-	// Calculate the absolute value of the difference
-	diffAbs := new(big.Int).Abs(diff)
+// Thresholds are the deviations that trigger a new answer. A zero threshold
+// is not set.
+type Thresholds struct {
+	// Relative is the deviation in percent of the absolute current answer.
+	Relative float64
+	// Absolute is the deviation in answer units, which must be exceeded.
+	Absolute float64
+	// Mode is ModeAnd or ModeOr, ModeAnd when empty.
+	Mode string
+}
 
-	// Calculate the threshold for 0.5% of the current value: threshold = current * 0.005
-	threshold := new(big.Int).Div(new(big.Int).Mul(current, big.NewInt(5)), big.NewInt(1000))
+// CheckDifference reports whether next deviates from current enough to be
+// submitted. The relative deviation is taken against the absolute value of
+// current, so that negative answers behave like positive ones. Any change from
+// a zero answer is an infinite relative deviation, and an unchanged answer
+// never deviates.
+func CheckDifference(current, next decimal.Decimal, thresholds Thresholds) bool {
+	diffAbs := next.Sub(current).Abs()
+	if diffAbs.IsZero() {
+		return false
+	}
+	relativeSet := thresholds.Relative > 0
+	absoluteSet := thresholds.Absolute > 0
+	if !relativeSet && !absoluteSet {
+		return true
+	}
 
-	// Check if the absolute difference is at least the threshold
-	return diffAbs.Cmp(threshold) >= 0
+	absoluteMet := diffAbs.GreaterThan(decimal.NewFromFloat(thresholds.Absolute))
+	relativeMet := current.IsZero() ||
+		diffAbs.Mul(hundred).GreaterThanOrEqual(current.Abs().Mul(decimal.NewFromFloat(thresholds.Relative)))
+
+	if thresholds.Mode == ModeOr {
+		return (relativeSet && relativeMet) || (absoluteSet && absoluteMet)
+	}
+	return (!relativeSet || relativeMet) && (!absoluteSet || absoluteMet)
 }
@@ -0,0 +1,62 @@
+package diffchecker
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDifference(t *testing.T) {
+	relative := Thresholds{Relative: 0.5}
+	absolute := Thresholds{Absolute: 10}
+	and := Thresholds{Relative: 0.5, Absolute: 10, Mode: ModeAnd}
+	or := Thresholds{Relative: 0.5, Absolute: 10, Mode: ModeOr}
+
+	tests := []struct {
+		name       string
+		current    string
+		next       string
+		thresholds Thresholds
+		want       bool
+	}{
+		{"relative below", "1000", "1004", relative, false},
+		{"relative exactly met", "1000", "1005", relative, true},
+		{"relative decrease", "1000", "995", relative, true},
+		{"relative fractional percent", "1000", "1001", Thresholds{Relative: 0.1}, true},
+		{"relative basis point", "10000", "10001", Thresholds{Relative: 0.01}, true},
+		{"unchanged", "1000", "1000", relative, false},
+		{"unchanged without thresholds", "1000", "1000", Thresholds{}, false},
+		{"any change without thresholds", "1000", "1001", Thresholds{}, true},
+
+		{"absolute not exceeded", "1000", "1010", absolute, false},
+		{"absolute exceeded", "1000", "1011", absolute, true},
+		{"absolute ignores the relative size", "1000000", "1000011", absolute, true},
+
+		{"and both met", "1000", "1011", and, true},
+		{"and only relative met", "1000", "1006", and, false},
+		{"and only absolute met", "100000", "100011", and, false},
+		{"empty mode is and", "1000", "1006", Thresholds{Relative: 0.5, Absolute: 10}, false},
+		{"or only relative met", "1000", "1006", or, true},
+		{"or only absolute met", "100000", "100011", or, true},
+		{"or none met", "100000", "100005", or, false},
+
+		{"zero to non-zero", "0", "1", relative, true},
+		{"zero to negative", "0", "-1", relative, true},
+		{"zero stays zero", "0", "0", relative, false},
+		{"zero within the absolute threshold", "0", "5", and, false},
+		{"zero beyond the absolute threshold", "0", "11", and, true},
+		{"non-zero to zero", "1000", "0", relative, true},
+
+		{"negative below", "-1000", "-1004", relative, false},
+		{"negative met", "-1000", "-1005", relative, true},
+		{"negative towards zero", "-1000", "-995", relative, true},
+		{"sign flip", "-1", "1", relative, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := CheckDifference(decimal.RequireFromString(tc.current), decimal.RequireFromString(tc.next), tc.thresholds)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
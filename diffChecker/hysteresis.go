@@ -0,0 +1,39 @@
+package diffchecker
+
+import "time"
+
+// Hysteresis holds deviations back until they persist, so that a single
+// spiky observation does not trigger a submission. It is not safe for
+// concurrent use.
+type Hysteresis struct {
+	// Observations is the number of consecutive deviating observations
+	// needed. Zero or one lets the first through.
+	Observations int
+	// Sustain is how long the deviation must last since the first deviating
+	// observation.
+	Sustain time.Duration
+
+	count int
+	since time.Time
+}
+
+// Observe records whether the observation made at now deviates and reports
+// whether the deviation persisted long enough to be submitted. An observation
+// that does not deviate starts over.
+func (h *Hysteresis) Observe(deviated bool, now time.Time) bool {
+	if !deviated {
+		h.Reset()
+		return false
+	}
+	if h.count == 0 {
+		h.since = now
+	}
+	h.count++
+	return h.count >= h.Observations && now.Sub(h.since) >= h.Sustain
+}
+
+// Reset forgets the deviating observations, as after a new answer.
+func (h *Hysteresis) Reset() {
+	h.count = 0
+	h.since = time.Time{}
+}
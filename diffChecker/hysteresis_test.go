@@ -0,0 +1,39 @@
+package diffchecker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHysteresis(t *testing.T) {
+	start := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	var none Hysteresis
+	assert.True(t, none.Observe(true, at(0)))
+	assert.False(t, none.Observe(false, at(1)))
+
+	observations := Hysteresis{Observations: 3}
+	assert.False(t, observations.Observe(true, at(0)))
+	assert.False(t, observations.Observe(true, at(1)))
+	assert.False(t, observations.Observe(false, at(2)), "a spike starts over")
+	assert.False(t, observations.Observe(true, at(3)))
+	assert.False(t, observations.Observe(true, at(4)))
+	assert.True(t, observations.Observe(true, at(5)))
+	observations.Reset()
+	assert.False(t, observations.Observe(true, at(6)))
+
+	sustained := Hysteresis{Sustain: time.Minute}
+	assert.False(t, sustained.Observe(true, at(0)))
+	assert.False(t, sustained.Observe(true, at(59)))
+	assert.True(t, sustained.Observe(true, at(60)))
+	assert.False(t, sustained.Observe(false, at(61)))
+	assert.False(t, sustained.Observe(true, at(90)))
+
+	both := Hysteresis{Observations: 3, Sustain: time.Minute}
+	assert.False(t, both.Observe(true, at(0)))
+	assert.False(t, both.Observe(true, at(60)))
+	assert.True(t, both.Observe(true, at(61)))
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"erinaceus_data_feeds/client"
 	logpoller "erinaceus_data_feeds/logPoller"
-	"os"
 	"sync"
 	"time"
 
@@ -15,37 +14,22 @@ import (
 
 var retryInterval = 5 * time.Second
 
-type CustomFormatter struct {
-	logrus.JSONFormatter
-}
-
-func (f *CustomFormatter) Format(entry *logrus.Entry) ([]byte, error) {
-	data, err := f.JSONFormatter.Format(entry)
-	if err != nil {
-		return nil, err
-	}
-	return append(data, '\n'), nil
-}
-
 type HeadTracker struct {
-	client    *client.Client
-	headers   chan *types.Header
-	logger    *logrus.Logger
-	sub       ethereum.Subscription
-	logPoller *logpoller.LogPoller
-	wg        sync.WaitGroup
+	client     *client.Client
+	headers    chan *types.Header
+	logger     *logrus.Logger
+	sub        ethereum.Subscription
+	logPollers []*logpoller.LogPoller
+	wg         sync.WaitGroup
 }
 
-func NewHeadTracker(client *client.Client, logPoller *logpoller.LogPoller) *HeadTracker {
-	logger := logrus.New()
-	logger.SetOutput(os.Stdout)
-	logger.SetFormatter(&CustomFormatter{})
+func NewHeadTracker(client *client.Client, logPollers []*logpoller.LogPoller, logger *logrus.Logger) *HeadTracker {
 	return &HeadTracker{
-		client:    client,
-		headers:   make(chan *types.Header),
-		logger:    logger,
-		logPoller: logPoller,
-		wg:        sync.WaitGroup{},
+		client:     client,
+		headers:    make(chan *types.Header),
+		logger:     logger,
+		logPollers: logPollers,
+		wg:         sync.WaitGroup{},
 	}
 }
 
@@ -119,7 +103,7 @@ func (ht *HeadTracker) processNewHead(header *types.Header) {
 		"Gas Used":    header.GasUsed,
 	}).Infoln("Received new head")
 
-	if err := ht.logPoller.PollLogs(); err != nil {
-		ht.logger.Errorf("Error processing requests: %v", err)
+	for _, logPoller := range ht.logPollers {
+		logPoller.NotifyNewHead(header.Number.Uint64())
 	}
 }
@@ -0,0 +1,474 @@
+package job
+
+import (
+	"erinaceus_data_feeds/config"
+	"erinaceus_data_feeds/services/pipeline"
+	ubig "erinaceus_data_feeds/utils/big"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"go.uber.org/multierr"
+)
+
+// FluxMonitorType is the only job type the node runs.
+const FluxMonitorType = "fluxmonitor"
+
+// FluxMonitorSpec is a declarative feed definition modeled on the Chainlink
+// flux monitor job spec.
+type FluxMonitorSpec struct {
+	Type              string  `toml:"type"`
+	SchemaVersion     uint32  `toml:"schemaVersion"`
+	Name              string  `toml:"name"`
+	ContractAddress   string  `toml:"contractAddress"`
+	Threshold         float64 `toml:"threshold"`
+	ThresholdUnit     string  `toml:"thresholdUnit"`
+	AbsoluteThreshold float64 `toml:"absoluteThreshold"`
+	ThresholdMode     string  `toml:"thresholdMode"`
+	// HysteresisObservations and HysteresisSustain hold deviations back until
+	// they persist, see config.Hysteresis.
+	HysteresisObservations int             `toml:"hysteresisObservations"`
+	HysteresisSustain      config.Duration `toml:"hysteresisSustain"`
+	IdleTimerPeriod        config.Duration `toml:"idleTimerPeriod"`
+	IdleTimerDisabled      bool            `toml:"idleTimerDisabled"`
+	// IdleTimerMode is fixed or round_age, see config.IdleTimer.
+	IdleTimerMode        string          `toml:"idleTimerMode"`
+	IdleTimerRandomDelay config.Duration `toml:"idleTimerRandomDelay"`
+	PollTimerPeriod      config.Duration `toml:"pollTimerPeriod"`
+	PollTimerDisabled    bool            `toml:"pollTimerDisabled"`
+	DrumbeatEnabled      bool            `toml:"drumbeatEnabled"`
+	DrumbeatSchedule     string          `toml:"drumbeatSchedule"`
+	DrumbeatRandomDelay  config.Duration `toml:"drumbeatRandomDelay"`
+	DrumbeatTimezone     string          `toml:"drumbeatTimezone"`
+	Decimals             *uint8          `toml:"decimals"`
+	Rounding             string          `toml:"rounding"`
+	MinPayment           ubig.Big        `toml:"minPayment"`
+	ReplayFromBlock      uint64          `toml:"replayFromBlock"`
+	LogPollInterval      config.Duration `toml:"logPollInterval"`
+	Observation          Observation     `toml:"observation"`
+	MarketHours          MarketHours     `toml:"marketHours"`
+	Guardrails           Guardrails      `toml:"guardrails"`
+	Profitability        Profitability   `toml:"profitability"`
+	// ObservationSource is the task pipeline producing the price, see
+	// pipeline.Parse.
+	ObservationSource string `toml:"observationSource"`
+
+	// Path is the file the spec was loaded from.
+	Path string `toml:"-"`
+}
+
+// Observation lists the HTTP JSON sources producing the feed's answer. A spec
+// with a single source may set its fields on the observation itself.
+type Observation struct {
+	ObservationSource
+	// Quorum is the number of sources that must answer, a majority when unset.
+	Quorum   int      `toml:"quorum"`
+	Outliers Outliers `toml:"outliers"`
+	Sampling Sampling `toml:"sampling"`
+	// CircuitBreaker stops fetching sources that keep failing.
+	CircuitBreaker CircuitBreaker      `toml:"circuitBreaker"`
+	Sources        []ObservationSource `toml:"sources"`
+}
+
+// Profitability defers submissions costing more gas than the round pays, see
+// config.Profitability.
+type Profitability struct {
+	Enabled                bool    `toml:"enabled"`
+	PaymentRate            float64 `toml:"paymentRate"`
+	AlwaysSubmitDeviations bool    `toml:"alwaysSubmitDeviations"`
+}
+
+// Guardrails block implausible answers, see config.Guardrails.
+type Guardrails struct {
+	MinPrice      *decimal.Decimal `toml:"minPrice"`
+	MaxPrice      *decimal.Decimal `toml:"maxPrice"`
+	MaxJump       *decimal.Decimal `toml:"maxJump"`
+	OverrideUntil time.Time        `toml:"overrideUntil"`
+	OverrideFile  string           `toml:"overrideFile"`
+}
+
+// MarketHours restricts submissions to the trading sessions of a market, see
+// config.MarketHours.
+type MarketHours struct {
+	Enabled               bool     `toml:"enabled"`
+	Timezone              string   `toml:"timezone"`
+	Days                  string   `toml:"days"`
+	Open                  string   `toml:"open"`
+	Close                 string   `toml:"close"`
+	Holidays              []string `toml:"holidays"`
+	DeviationOutsideHours bool     `toml:"deviationOutsideHours"`
+}
+
+// CircuitBreaker skips a source for Cooldown after FailureThreshold
+// consecutive failures.
+type CircuitBreaker struct {
+	Disabled         bool            `toml:"disabled"`
+	FailureThreshold int             `toml:"failureThreshold"`
+	Cooldown         config.Duration `toml:"cooldown"`
+}
+
+// Sampling averages every source over a rolling window of samples.
+type Sampling struct {
+	Mode       string          `toml:"mode"`
+	Interval   config.Duration `toml:"interval"`
+	Window     config.Duration `toml:"window"`
+	MinSamples int             `toml:"minSamples"`
+}
+
+// Outliers configures the outlier filter applied across sources.
+type Outliers struct {
+	Method        string  `toml:"method"`
+	MaxDeviation  float64 `toml:"maxDeviation"`
+	MADMultiplier float64 `toml:"madMultiplier"`
+	TrimFraction  float64 `toml:"trimFraction"`
+}
+
+// ObservationSource is one price source, an HTTP JSON API unless Type selects
+// another adapter.
+type ObservationSource struct {
+	Type       string `toml:"type"`
+	Name       string `toml:"name"`
+	URL        string `toml:"url"`
+	HeaderName string `toml:"headerName"`
+	APIKey     string `toml:"apiKey"`
+	JSONPath   string `toml:"jsonPath"`
+	// VolumeJSONPath extracts the traded volume used by vwap sampling.
+	VolumeJSONPath string `toml:"volumeJsonPath"`
+	// TimestampJSONPath extracts the time the price was last updated, checked
+	// against MaxAge.
+	TimestampJSONPath string          `toml:"timestampJsonPath"`
+	Body              string          `toml:"body"`
+	Value             string          `toml:"value"`
+	Path              string          `toml:"path"`
+	Address           string          `toml:"address"`
+	Auth              ObservationAuth `toml:"auth"`
+	// Numerator and Denominator are the inputs of a derived source.
+	Numerator   []ObservationSource `toml:"numerator"`
+	Denominator []ObservationSource `toml:"denominator"`
+	MaxAge      config.Duration     `toml:"maxAge"`
+	Params      map[string]string   `toml:"params"`
+	Timeout     config.Duration     `toml:"timeout"`
+}
+
+// ObservationAuth authenticates the requests of an HTTP source.
+type ObservationAuth struct {
+	Type            string `toml:"type"`
+	Name            string `toml:"name"`
+	Key             string `toml:"key"`
+	Username        string `toml:"username"`
+	Password        string `toml:"password"`
+	Secret          string `toml:"secret"`
+	SignatureHeader string `toml:"signatureHeader"`
+	TimestampHeader string `toml:"timestampHeader"`
+}
+
+func (o ObservationSource) source() config.Source {
+	source := config.Source{
+		Type:              o.Type,
+		Name:              o.Name,
+		URL:               o.URL,
+		HeaderName:        o.HeaderName,
+		APIKey:            o.APIKey,
+		JSONPath:          o.JSONPath,
+		VolumeJSONPath:    o.VolumeJSONPath,
+		TimestampJSONPath: o.TimestampJSONPath,
+		Body:              o.Body,
+		Value:             o.Value,
+		Path:              o.Path,
+		Address:           o.Address,
+		Auth: config.Auth{
+			Type:            o.Auth.Type,
+			Name:            o.Auth.Name,
+			Key:             o.Auth.Key,
+			Username:        o.Auth.Username,
+			Password:        o.Auth.Password,
+			Secret:          o.Auth.Secret,
+			SignatureHeader: o.Auth.SignatureHeader,
+			TimestampHeader: o.Auth.TimestampHeader,
+		},
+		MaxAge:  o.MaxAge,
+		Params:  o.Params,
+		Timeout: o.Timeout,
+	}
+	for _, input := range o.Numerator {
+		source.Numerator = append(source.Numerator, input.source())
+	}
+	for _, input := range o.Denominator {
+		source.Denominator = append(source.Denominator, input.source())
+	}
+	return source
+}
+
+// specFieldNames maps config.Feed field names to their spec keys so that
+// validation errors name the key written in the spec file.
+var specFieldNames = map[string]string{
+	"address":                           "contractAddress",
+	"absolute_threshold":                "absoluteThreshold",
+	"threshold_unit":                    "thresholdUnit",
+	"threshold_mode":                    "thresholdMode",
+	"hysteresis.observations":           "hysteresisObservations",
+	"hysteresis.sustain":                "hysteresisSustain",
+	"idle_timer.period":                 "idleTimerPeriod",
+	"idle_timer.mode":                   "idleTimerMode",
+	"idle_timer.random_delay":           "idleTimerRandomDelay",
+	"poll_timer.period":                 "pollTimerPeriod",
+	"poll_timer.disabled":               "pollTimerDisabled",
+	"drumbeat.schedule":                 "drumbeatSchedule",
+	"drumbeat.random_delay":             "drumbeatRandomDelay",
+	"drumbeat.timezone":                 "drumbeatTimezone",
+	"market_hours":                      "marketHours",
+	"guardrails.max_price":              "guardrails.maxPrice",
+	"guardrails.max_jump":               "guardrails.maxJump",
+	"profitability.payment_rate":        "profitability.paymentRate",
+	"min_payment":                       "minPayment",
+	"replay_from_block":                 "replayFromBlock",
+	"log_poll_interval":                 "logPollInterval",
+	"quorum":                            "observation.quorum",
+	"outliers.method":                   "observation.outliers.method",
+	"outliers.max_deviation":            "observation.outliers.maxDeviation",
+	"outliers.mad_multiplier":           "observation.outliers.madMultiplier",
+	"outliers.trim_fraction":            "observation.outliers.trimFraction",
+	"sampling.mode":                     "observation.sampling.mode",
+	"sampling.interval":                 "observation.sampling.interval",
+	"sampling.window":                   "observation.sampling.window",
+	"sampling.min_samples":              "observation.sampling.minSamples",
+	"circuit_breaker.failure_threshold": "observation.circuitBreaker.failureThreshold",
+	"circuit_breaker.cooldown":          "observation.circuitBreaker.cooldown",
+}
+
+// sourceFieldNames maps config.Source field names to their spec keys.
+var sourceFieldNames = map[string]string{
+	"header_name":         "headerName",
+	"api_key":             "apiKey",
+	"json_path":           "jsonPath",
+	"volume_json_path":    "volumeJsonPath",
+	"timestamp_json_path": "timestampJsonPath",
+	"signature_header":    "signatureHeader",
+	"timestamp_header":    "timestampHeader",
+	"max_age":             "maxAge",
+}
+
+func specFieldName(field string) string {
+	if name, ok := specFieldNames[field]; ok {
+		return name
+	}
+	for _, prefix := range []string{"source.", "sources["} {
+		if !strings.HasPrefix(field, prefix) {
+			continue
+		}
+		if i := strings.LastIndex(field, "."); i >= 0 {
+			if name, ok := sourceFieldNames[field[i+1:]]; ok {
+				field = field[:i+1] + name
+			}
+		}
+		return "observation." + strings.TrimPrefix(field, "source.")
+	}
+	return field
+}
+
+// ParseSpec decodes a TOML flux monitor job spec.
+func ParseSpec(data string) (*FluxMonitorSpec, error) {
+	var spec FluxMonitorSpec
+	md, err := toml.Decode(data, &spec)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown field %q", undecoded[0].String())
+	}
+	return &spec, nil
+}
+
+// Feed converts the spec to the feed configuration the services run with.
+// Unset periods take the feed defaults.
+func (s *FluxMonitorSpec) Feed() config.Feed {
+	feed := config.Feed{
+		Name:              s.Name,
+		Address:           s.ContractAddress,
+		ReplayFromBlock:   s.ReplayFromBlock,
+		LogPollInterval:   s.LogPollInterval,
+		Threshold:         s.Threshold,
+		ThresholdUnit:     s.ThresholdUnit,
+		AbsoluteThreshold: s.AbsoluteThreshold,
+		ThresholdMode:     s.ThresholdMode,
+		Hysteresis:        config.Hysteresis{Observations: s.HysteresisObservations, Sustain: s.HysteresisSustain},
+		PollTimer:         config.Timer{Period: s.PollTimerPeriod, Disabled: s.PollTimerDisabled},
+		IdleTimer: config.IdleTimer{
+			Period:      s.IdleTimerPeriod,
+			Disabled:    s.IdleTimerDisabled,
+			Mode:        s.IdleTimerMode,
+			RandomDelay: s.IdleTimerRandomDelay,
+		},
+		Drumbeat: config.Drumbeat{
+			Enabled:     s.DrumbeatEnabled,
+			Schedule:    s.DrumbeatSchedule,
+			Timezone:    s.DrumbeatTimezone,
+			RandomDelay: s.DrumbeatRandomDelay,
+		},
+		Guardrails: config.Guardrails{
+			MinPrice:      s.Guardrails.MinPrice,
+			MaxPrice:      s.Guardrails.MaxPrice,
+			MaxJump:       s.Guardrails.MaxJump,
+			OverrideUntil: s.Guardrails.OverrideUntil,
+			OverrideFile:  s.Guardrails.OverrideFile,
+		},
+		Profitability: config.Profitability{
+			Enabled:                s.Profitability.Enabled,
+			PaymentRate:            s.Profitability.PaymentRate,
+			AlwaysSubmitDeviations: s.Profitability.AlwaysSubmitDeviations,
+		},
+		MarketHours: config.MarketHours{
+			Enabled:               s.MarketHours.Enabled,
+			Timezone:              s.MarketHours.Timezone,
+			Days:                  s.MarketHours.Days,
+			Open:                  s.MarketHours.Open,
+			Close:                 s.MarketHours.Close,
+			Holidays:              s.MarketHours.Holidays,
+			DeviationOutsideHours: s.MarketHours.DeviationOutsideHours,
+		},
+		Decimals:          s.Decimals,
+		Rounding:          s.Rounding,
+		MinPayment:        s.MinPayment,
+		Source:            s.Observation.source(),
+		Quorum:            s.Observation.Quorum,
+		ObservationSource: s.ObservationSource,
+		Outliers: config.OutlierFilter{
+			Method:        s.Observation.Outliers.Method,
+			MaxDeviation:  s.Observation.Outliers.MaxDeviation,
+			MADMultiplier: s.Observation.Outliers.MADMultiplier,
+			TrimFraction:  s.Observation.Outliers.TrimFraction,
+		},
+		Sampling: config.Sampling{
+			Mode:       s.Observation.Sampling.Mode,
+			Interval:   s.Observation.Sampling.Interval,
+			Window:     s.Observation.Sampling.Window,
+			MinSamples: s.Observation.Sampling.MinSamples,
+		},
+		CircuitBreaker: config.CircuitBreaker{
+			Disabled:         s.Observation.CircuitBreaker.Disabled,
+			FailureThreshold: s.Observation.CircuitBreaker.FailureThreshold,
+			Cooldown:         s.Observation.CircuitBreaker.Cooldown,
+		},
+	}
+	for _, source := range s.Observation.Sources {
+		feed.Sources = append(feed.Sources, source.source())
+	}
+	feed.SetDefaults()
+	return feed
+}
+
+// Validate checks the spec and returns every problem, each naming the spec
+// file and key.
+func (s *FluxMonitorSpec) Validate() (err error) {
+	if s.Type != FluxMonitorType {
+		err = multierr.Append(err, s.invalid("type", fmt.Sprintf("must be %q, got %q", FluxMonitorType, s.Type)))
+	}
+	if s.SchemaVersion != 1 {
+		err = multierr.Append(err, s.invalid("schemaVersion", fmt.Sprintf("must be 1, got %d", s.SchemaVersion)))
+	}
+	if s.ObservationSource != "" {
+		if _, perr := pipeline.Parse(s.ObservationSource); perr != nil {
+			err = multierr.Append(err, s.invalid("observationSource", perr.Error()))
+		}
+	}
+	for _, ferr := range multierr.Errors(s.Feed().Validate("spec")) {
+		var fieldErr *config.FieldError
+		if !errors.As(ferr, &fieldErr) {
+			err = multierr.Append(err, ferr)
+			continue
+		}
+		field := specFieldName(strings.TrimPrefix(fieldErr.Field, "spec."))
+		err = multierr.Append(err, s.invalid(field, fieldErr.Msg))
+	}
+	return err
+}
+
+func (s *FluxMonitorSpec) invalid(field, msg string) error {
+	return fmt.Errorf("invalid job spec %s: %s: %s", s.Path, field, msg)
+}
+
+// LoadSpecs reads every spec matched by pattern, which is either a directory
+// holding *.toml files or a glob.
+func LoadSpecs(pattern string) ([]*FluxMonitorSpec, error) {
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*.toml")
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job spec pattern %q: %v", pattern, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no job specs found at %q", pattern)
+	}
+	sort.Strings(paths)
+
+	var specs []*FluxMonitorSpec
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job spec %s: %v", path, err)
+		}
+		spec, err := ParseSpec(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse job spec %s: %v", path, err)
+		}
+		spec.Path = path
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// LoadFeeds returns the feeds of the config followed by the feeds of its job
+// specs. Every spec is validated and feed names and contract addresses must be
+// unique across both, so that all errors surface before any service starts.
+func LoadFeeds(cfg *config.Config) ([]config.Feed, error) {
+	feeds := cfg.AllFeeds()
+	origins := make([]string, 0, len(feeds))
+	for range feeds {
+		origins = append(origins, "config")
+	}
+
+	if cfg.JobSpecs != "" {
+		specs, err := LoadSpecs(cfg.JobSpecs)
+		if err != nil {
+			return nil, err
+		}
+		var verr error
+		for _, spec := range specs {
+			verr = multierr.Append(verr, spec.Validate())
+			feeds = append(feeds, spec.Feed())
+			origins = append(origins, spec.Path)
+		}
+		if verr != nil {
+			return nil, verr
+		}
+	}
+	if len(feeds) == 0 {
+		return nil, fmt.Errorf("no feeds configured")
+	}
+
+	var err error
+	names := make(map[string]string)
+	addresses := make(map[common.Address]string)
+	for i, feed := range feeds {
+		if origin, ok := names[feed.Name]; ok {
+			err = multierr.Append(err, fmt.Errorf("feed name %q of %s is already used by %s", feed.Name, origins[i], origin))
+		}
+		names[feed.Name] = origins[i]
+		if origin, ok := addresses[feed.ContractAddress()]; ok {
+			err = multierr.Append(err, fmt.Errorf("contract address %s of %s is already used by %s", feed.Address, origins[i], origin))
+		}
+		addresses[feed.ContractAddress()] = origins[i]
+	}
+	if err != nil {
+		return nil, err
+	}
+	return feeds, nil
+}
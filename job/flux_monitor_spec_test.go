@@ -0,0 +1,190 @@
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"erinaceus_data_feeds/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const xrpSpec = `
+type = "fluxmonitor"
+schemaVersion = 1
+name = "XRP / USD"
+contractAddress = "0x46C35E26653eB21A474E74887a9CFB0e61620175"
+threshold = 0.5
+absoluteThreshold = 0.01
+idleTimerPeriod = "1h"
+pollTimerPeriod = "1m"
+drumbeatEnabled = true
+drumbeatSchedule = "@every 20m"
+drumbeatRandomDelay = "10s"
+minPayment = "1000000000000000000"
+
+[observation]
+url = "http://localhost:8080/xrp"
+jsonPath = "ripple.usd"
+`
+
+func writeSpec(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+}
+
+func TestParseSpec(t *testing.T) {
+	spec, err := ParseSpec(xrpSpec)
+	require.NoError(t, err)
+	require.NoError(t, spec.Validate())
+
+	feed := spec.Feed()
+	assert.Equal(t, "XRP / USD", feed.Name)
+	assert.Equal(t, 0.01, feed.AbsoluteThreshold)
+	assert.Equal(t, time.Hour, feed.IdleTimer.Period.D())
+	assert.Equal(t, time.Minute, feed.PollTimer.Period.D())
+	assert.True(t, feed.Drumbeat.Enabled)
+	assert.Equal(t, "1000000000000000000", feed.MinContractPayment().String())
+	assert.Equal(t, 30*time.Second, feed.LogPollInterval.D())
+	assert.Equal(t, "ripple.usd", feed.Source.JSONPath)
+}
+
+func TestParseSpecUnknownField(t *testing.T) {
+	_, err := ParseSpec(xrpSpec + "\nbogus = 1\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bogus")
+}
+
+func TestValidateNamesSpecKeys(t *testing.T) {
+	spec, err := ParseSpec(`
+type = "directrequest"
+schemaVersion = 1
+name = "broken"
+contractAddress = "0x46C35E26653eB21A474E74887a9CFB0e6162017"
+drumbeatEnabled = true
+drumbeatSchedule = "0 25 * * *"
+`)
+	require.NoError(t, err)
+	spec.Path = "broken.toml"
+
+	err = spec.Validate()
+	require.Error(t, err)
+	for _, msg := range []string{
+		"invalid job spec broken.toml: type",
+		"invalid job spec broken.toml: contractAddress",
+		"invalid job spec broken.toml: drumbeatSchedule",
+		"invalid job spec broken.toml: observation.url",
+		"invalid job spec broken.toml: observation.jsonPath",
+	} {
+		assert.Contains(t, err.Error(), msg)
+	}
+}
+
+func TestLoadFeeds(t *testing.T) {
+	dir := t.TempDir()
+	writeSpec(t, dir, "xrp.toml", xrpSpec)
+
+	cfg := config.Defaults()
+	cfg.JobSpecs = dir
+
+	feeds, err := LoadFeeds(cfg)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, "XRP / USD", feeds[0].Name)
+}
+
+func TestLoadFeedsDuplicateAddress(t *testing.T) {
+	dir := t.TempDir()
+	writeSpec(t, dir, "a.toml", xrpSpec)
+	writeSpec(t, dir, "b.toml", xrpSpec)
+
+	cfg := config.Defaults()
+	cfg.JobSpecs = filepath.Join(dir, "*.toml")
+
+	_, err := LoadFeeds(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `feed name "XRP / USD" of `+filepath.Join(dir, "b.toml")+" is already used by "+filepath.Join(dir, "a.toml"))
+	assert.Contains(t, err.Error(), "contract address")
+}
+
+func TestLoadFeedsNoSpecs(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JobSpecs = t.TempDir()
+
+	_, err := LoadFeeds(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no job specs found")
+}
+
+func TestExampleSpecsAreValid(t *testing.T) {
+	specs, err := LoadSpecs("../examples/jobs")
+	require.NoError(t, err)
+	for _, spec := range specs {
+		assert.NoError(t, spec.Validate(), spec.Path)
+	}
+}
+
+func TestParseSpecSources(t *testing.T) {
+	spec, err := ParseSpec(`
+type = "fluxmonitor"
+schemaVersion = 1
+name = "XRP / USD"
+contractAddress = "0x46C35E26653eB21A474E74887a9CFB0e61620175"
+
+[observation]
+quorum = 2
+
+[[observation.sources]]
+name = "a"
+url = "http://localhost:8080/a"
+jsonPath = "p"
+
+[[observation.sources]]
+name = "b"
+url = "http://localhost:8080/b"
+`)
+	require.NoError(t, err)
+	spec.Path = "sources.toml"
+
+	feed := spec.Feed()
+	require.Len(t, feed.AllSources(), 2)
+	assert.Equal(t, 2, feed.MinResponses())
+
+	err = spec.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "observation.sources[1].jsonPath")
+}
+
+func TestParseSpecObservationSource(t *testing.T) {
+	spec, err := ParseSpec(`
+type = "fluxmonitor"
+schemaVersion = 1
+name = "EUR / XRP"
+contractAddress = "0x46C35E26653eB21A474E74887a9CFB0e61620175"
+observationSource = """
+	eur [type=http url="http://localhost:8080/eur"];
+	eur_parse [type=jsonparse path="usd"];
+	xrp [type=source name="xrp"];
+	cross [type=divide];
+	eur -> eur_parse -> cross;
+	xrp -> cross;
+"""
+
+[[observation.sources]]
+name = "xrp"
+url = "http://localhost:8080/xrp"
+jsonPath = "ripple.usd"
+`)
+	require.NoError(t, err)
+	spec.Path = "eur_xrp.toml"
+	require.NoError(t, spec.Validate())
+	assert.Contains(t, spec.Feed().ObservationSource, "cross [type=divide]")
+
+	spec.ObservationSource = "eur [type=http]"
+	err = spec.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid job spec eur_xrp.toml: observationSource: line 1: task eur: url must be set")
+}
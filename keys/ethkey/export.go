@@ -3,7 +3,6 @@ package ethkey
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/google/uuid"
@@ -13,8 +12,6 @@ import (
 	"erinaceus_data_feeds/utils"
 )
 
-var basepath, _ = os.Getwd()
-
 type EncryptedEthKeyExport struct {
 	KeyType string              `json:"keyType"`
 	Address EIP55Address        `json:"address"`
@@ -35,18 +32,17 @@ func (key KeyV2) ToEncryptedJSON(password string, scryptParams utils.ScryptParam
 	return keystore.EncryptKey(dKey, password, scryptParams.N, scryptParams.P)
 }
 
-func GetKeyIfEnvSet() (KeyV2, error) {
-	keyFilePath := os.Getenv("EC_FTN_KEY_JSON_PATH")
-	keyPassword := os.Getenv("EC_FTN_KEY_PASSWORD")
-
+// GetKeyFromFile decrypts the key stored at keyFilePath. It returns an empty
+// key when no file exists yet.
+func GetKeyFromFile(keyFilePath, keyPassword string) (KeyV2, error) {
 	if keyPassword == "" {
-		errorMsg := "EC_FTN_KEY_PASSWORD is not set. Please set it and re-run the program"
+		errorMsg := "FTN key password is not set. Please set it and re-run the program"
 		logrus.Error(errorMsg)
 		return KeyV2{}, fmt.Errorf(errorMsg)
 	}
 
 	if keyFilePath == "" {
-		keyFilePath = filepath.Join(basepath, "ftn_key.json")
+		keyFilePath = "ftn_key.json"
 	}
 
 	if !utils.FileExists(keyFilePath) {
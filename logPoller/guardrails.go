@@ -0,0 +1,88 @@
+package logpoller
+
+import (
+	"erinaceus_data_feeds/config"
+	"erinaceus_data_feeds/utils/scale"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrGuardrail is wrapped by the errors of answers blocked by the guardrails
+// of a feed.
+var ErrGuardrail = errors.New("blocked by guardrail")
+
+// guardrails check answers against the plausible prices of the feed, the
+// largest jump from the on-chain answer and the submission bounds of the
+// aggregator.
+type guardrails struct {
+	config.Guardrails
+	decimals uint8
+	// minAnswer and maxAnswer are the submission bounds of the aggregator,
+	// nil when unknown.
+	minAnswer *big.Int
+	maxAnswer *big.Int
+}
+
+// check returns an error wrapping ErrGuardrail when answer must not replace
+// the current on-chain answer at now. A nil current skips the jump check.
+func (g guardrails) check(answer, current *big.Int, now time.Time) error {
+	price := scale.FromSubmission(answer, g.decimals)
+	if g.MinPrice == nil && price.Sign() <= 0 {
+		return fmt.Errorf("%w: price %s is not positive", ErrGuardrail, price)
+	}
+	if g.MinPrice != nil && price.LessThan(*g.MinPrice) {
+		return fmt.Errorf("%w: price %s is below the minimum price %s", ErrGuardrail, price, g.MinPrice)
+	}
+	if g.MaxPrice != nil && price.GreaterThan(*g.MaxPrice) {
+		return fmt.Errorf("%w: price %s is above the maximum price %s", ErrGuardrail, price, g.MaxPrice)
+	}
+	if g.minAnswer != nil && answer.Cmp(g.minAnswer) < 0 {
+		return fmt.Errorf("%w: answer %s is below the aggregator minimum submission value %s", ErrGuardrail, answer, g.minAnswer)
+	}
+	if g.maxAnswer != nil && answer.Cmp(g.maxAnswer) > 0 {
+		return fmt.Errorf("%w: answer %s is above the aggregator maximum submission value %s", ErrGuardrail, answer, g.maxAnswer)
+	}
+	// A feed without an answer yet has nothing to jump from.
+	if g.MaxJump == nil || current == nil || current.Sign() == 0 || now.Before(g.OverrideUntil) {
+		return nil
+	}
+	from := decimal.NewFromBigInt(current, 0)
+	jump := decimal.NewFromBigInt(answer, 0).Sub(from).Abs().Mul(decimal.NewFromInt(100)).Div(from.Abs())
+	if jump.GreaterThan(*g.MaxJump) {
+		return fmt.Errorf("%w: answer %s jumps %s%% from the on-chain answer %s, more than %s%%", ErrGuardrail, answer, jump.StringFixed(2), current, g.MaxJump)
+	}
+	return nil
+}
+
+// withOverride returns g with the override time of its override file, when
+// later than the configured one. A missing or empty file sets none.
+func (g guardrails) withOverride() (guardrails, error) {
+	if g.OverrideFile == "" {
+		return g, nil
+	}
+	data, err := os.ReadFile(g.OverrideFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return g, nil
+	}
+	if err != nil {
+		return g, fmt.Errorf("failed to read guardrail override %v", err)
+	}
+	text := strings.TrimSpace(string(data))
+	if text == "" {
+		return g, nil
+	}
+	until, err := time.Parse(time.RFC3339, text)
+	if err != nil {
+		return g, fmt.Errorf("invalid guardrail override %s: %v", g.OverrideFile, err)
+	}
+	if until.After(g.OverrideUntil) {
+		g.OverrideUntil = until
+	}
+	return g, nil
+}
@@ -3,58 +3,91 @@ package logpoller
 import (
 	"context"
 	"erinaceus_data_feeds/client"
+	"erinaceus_data_feeds/config"
 	aggregator "erinaceus_data_feeds/contract"
 	diffchecker "erinaceus_data_feeds/diffChecker"
+	paymentchecker "erinaceus_data_feeds/payment_checker"
 	"erinaceus_data_feeds/services/timer"
+	"erinaceus_data_feeds/services/txmanager"
 	wallet_service "erinaceus_data_feeds/services/wallet"
+	"erinaceus_data_feeds/utils/scale"
 	"fmt"
 	"math/big"
-	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
 
-// CustomFormatter is a Logrus formatter that adds two newline characters to log entries.
-type CustomFormatter struct {
-	logrus.JSONFormatter
+// Trigger is the reason of a submission.
+type Trigger string
+
+// Submission triggers. Idle timer and drumbeat submissions are heartbeats.
+const (
+	TriggerDeviation Trigger = "deviation"
+	TriggerRound     Trigger = "round"
+	TriggerIdle      Trigger = "idle"
+	TriggerDrumbeat  Trigger = "drumbeat"
+)
+
+func (t Trigger) heartbeat() bool {
+	return t == TriggerIdle || t == TriggerDrumbeat
 }
 
-// Format formats the log entry and adds two newline characters to the end.
-func (f *CustomFormatter) Format(entry *logrus.Entry) ([]byte, error) {
-	data, err := f.JSONFormatter.Format(entry)
-	if err != nil {
-		return nil, err
-	}
-	return append(data, '\n'), nil
+// maxLogRange is the most blocks filtered at once, below the range limits of
+// common RPC providers.
+const maxLogRange = 5000
+
+// logReader is the part of the node client the logs are polled through.
+type logReader interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error)
 }
 
 type LogPoller struct {
 	client          *client.Client
+	logs            logReader
 	contractAddress common.Address
+	// replayFromBlock is the next block to poll logs from.
 	replayFromBlock uint64
+	// handledRound is the latest round handed to the listener.
+	handledRound    uint64
 	fromPoller      bool
 	pollTicker      time.Ticker
+	pollInterval    time.Duration
 	eventSignatures []common.Hash
-	ReplayFromBlock uint64
 	NewHeadCh       chan uint64
 	walletService   *wallet_service.WalletService
+	txManager       *txmanager.TxManager
 	logchanel       chan *aggregator.AggregatorNewRound
 	pendingRound    uint32
-	latestAnswer    float64
+	thresholds      diffchecker.Thresholds
+	hysteresis      *diffchecker.Hysteresis
+	guardrails      guardrails
+	blocked         atomic.Uint64
+	underfunded     atomic.Uint64
+	minPayment      *big.Int
+	profitability   config.Profitability
+	unprofitable    atomic.Uint64
+	abi             abi.ABI
+	decimals        uint8
+	rounding        scale.RoundingMode
 	Mu              sync.Mutex
-	logger          *logrus.Logger
+	logger          *logrus.Entry
 	aggregator      *aggregator.Aggregator
 	timer           *timer.Timer
 }
 
-func NewLogPoller(client *client.Client, replayFromBlock uint64, contractAddress common.Address, walletService *wallet_service.WalletService, timer *timer.Timer) (*LogPoller, error) {
+func NewLogPoller(client *client.Client, feed config.Feed, walletService *wallet_service.WalletService, txManager *txmanager.TxManager, timer *timer.Timer, logger *logrus.Entry) (*LogPoller, error) {
+	contractAddress := feed.ContractAddress()
 	parsedABI, err := abi.JSON(strings.NewReader(aggregator.AggregatorABI))
 	if err != nil {
 		return nil, err
@@ -75,25 +108,53 @@ func NewLogPoller(client *client.Client, replayFromBlock uint64, contractAddress
 		return nil, fmt.Errorf("event 'AnswerUpdated' not found in contract ABI")
 	}
 
-	logger := logrus.New()
-	logger.SetOutput(os.Stdout)
-	logger.SetFormatter(&CustomFormatter{})
+	decimals := feed.Decimals
+	if decimals == nil {
+		onChain, err := aggregatorContract.Decimals(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get aggregator decimals %v", err)
+		}
+		decimals = &onChain
+	}
+
+	minAnswer, err := aggregatorContract.MinSubmissionValue(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get aggregator min submission value %v", err)
+	}
+	maxAnswer, err := aggregatorContract.MaxSubmissionValue(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get aggregator max submission value %v", err)
+	}
 
-	logger.Info("Starting log poller ...")
-	time.Sleep(1 * time.Second)
+	logger.WithField("Decimals", *decimals).Info("Starting log poller ...")
 
 	return &LogPoller{
 		client:          client,
+		logs:            client,
 		contractAddress: contractAddress,
 
-		replayFromBlock: replayFromBlock,
+		replayFromBlock: feed.ReplayFromBlock,
+		thresholds:      feed.Thresholds(),
+		hysteresis:      feed.Hysteresis.Checker(),
+		guardrails: guardrails{
+			Guardrails: feed.Guardrails,
+			decimals:   *decimals,
+			minAnswer:  minAnswer,
+			maxAnswer:  maxAnswer,
+		},
+		minPayment:      feed.MinContractPayment(),
+		profitability:   feed.Profitability,
+		abi:             parsedABI,
+		decimals:        *decimals,
+		rounding:        feed.RoundingMode(),
 		logger:          logger,
 		fromPoller:      false,
 		pendingRound:    uint32(0),
 		walletService:   walletService,
-		NewHeadCh:       make(chan uint64),
-		latestAnswer:    0.0,
-		pollTicker:      *time.NewTicker(30 * time.Second),
+		txManager:       txManager,
+		NewHeadCh:       make(chan uint64, 1),
+		pollInterval:    feed.LogPollInterval.D(),
+		pollTicker:      *time.NewTicker(feed.LogPollInterval.D()),
 		logchanel:       make(chan *aggregator.AggregatorNewRound),
 		aggregator:      aggregatorContract,
 		eventSignatures: []common.Hash{newRoundSig, answerUpdatedSig},
@@ -101,45 +162,95 @@ func NewLogPoller(client *client.Client, replayFromBlock uint64, contractAddress
 	}, nil
 }
 
-func (lp *LogPoller) PollLogs() error {
-	query := ethereum.FilterQuery{
-		Addresses: []common.Address{lp.contractAddress},
-		Topics:    [][]common.Hash{lp.eventSignatures},
-		FromBlock: new(big.Int).SetUint64(lp.ReplayFromBlock),
-		ToBlock:   nil,
-	}
-	lb, err := lp.client.EthClient.BlockNumber(context.Background())
-	if err != nil {
-		return fmt.Errorf("failed to get latest block %v", err)
+// PollLogs processes the logs of the aggregator from the next unprocessed
+// block up to head, in ranges of at most maxLogRange blocks. Rounds older than
+// the latest on-chain round are not handed over, so that replaying history
+// answers the current round only.
+func (lp *LogPoller) PollLogs(head uint64) error {
+	if lp.replayFromBlock > head {
+		return nil
 	}
-	lp.replayFromBlock = lb
-	logs, err := lp.client.FilterLogs(context.Background(), query)
+	latestRound, err := lp.aggregator.LatestRound(nil)
 	if err != nil {
-		errorMsg := fmt.Sprintf("error filter logs reason : %s", err)
-		lp.logger.Errorf(errorMsg)
-		return fmt.Errorf(errorMsg)
+		return fmt.Errorf("failed to get latest round %v", err)
 	}
-	recentRoundId, err := lp.aggregator.LatestRound(nil)
-	if err != nil {
-		return fmt.Errorf("failed to get latest round Id %v", err)
+	for lp.replayFromBlock <= head {
+		to := head
+		if to-lp.replayFromBlock >= maxLogRange {
+			to = lp.replayFromBlock + maxLogRange - 1
+		}
+		logs, err := lp.logs.FilterLogs(context.Background(), ethereum.FilterQuery{
+			Addresses: []common.Address{lp.contractAddress},
+			Topics:    [][]common.Hash{lp.eventSignatures},
+			FromBlock: new(big.Int).SetUint64(lp.replayFromBlock),
+			ToBlock:   new(big.Int).SetUint64(to),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to filter logs from block %d to %d %v", lp.replayFromBlock, to, err)
+		}
+		lp.processLogs(logs, latestRound)
+		lp.replayFromBlock = to + 1
 	}
+	return nil
+}
 
+// processLogs arms the heartbeat on answer updates and hands the latest new
+// round not handled yet to the listener, unless it is older than latestRound.
+// Earlier rounds are over once a later one started.
+func (lp *LogPoller) processLogs(logs []types.Log, latestRound *big.Int) {
+	var latest *aggregator.AggregatorNewRound
 	for _, log := range logs {
+		if len(log.Topics) > 0 && log.Topics[0] == lp.eventSignatures[1] {
+			if updated, err := lp.aggregator.ParseAnswerUpdated(log); err == nil {
+				lp.timer.ArmHeartbeat(time.Unix(updated.UpdatedAt.Int64(), 0))
+			}
+			continue
+		}
 		newRound, err := lp.aggregator.ParseNewRound(log)
 		if err != nil {
 			continue
 		}
-		if newRound.RoundId.Cmp(recentRoundId) != -1 {
-			lp.logchanel <- newRound
+		if latest == nil || newRound.RoundId.Cmp(latest.RoundId) > 0 {
+			latest = newRound
 		}
 	}
-	return nil
+	if latest == nil || !latest.RoundId.IsUint64() || latest.RoundId.Uint64() <= lp.handledRound {
+		return
+	}
+	if latest.RoundId.Cmp(latestRound) < 0 {
+		return
+	}
+	lp.handledRound = latest.RoundId.Uint64()
+	lp.logchanel <- latest
 }
 
+// NotifyNewHead wakes the polling loop for a new block without blocking the
+// caller while a previous poll is still running.
+func (lp *LogPoller) NotifyNewHead(head uint64) {
+	select {
+	case lp.NewHeadCh <- head:
+	default:
+	}
+}
+
+// StartPollingLogs polls the logs up to every new head, and up to the latest
+// block each poll interval in case heads are missed.
 func (lp *LogPoller) StartPollingLogs() {
 	for {
-		<-lp.pollTicker.C
-		lp.PollLogs()
+		var head uint64
+		select {
+		case <-lp.pollTicker.C:
+			latest, err := lp.logs.BlockNumber(context.Background())
+			if err != nil {
+				lp.logger.Errorf("failed to get latest block %v", err)
+				continue
+			}
+			head = latest
+		case head = <-lp.NewHeadCh:
+		}
+		if err := lp.PollLogs(head); err != nil {
+			lp.logger.Errorf("Error polling logs: %v", err)
+		}
 	}
 }
 
@@ -156,26 +267,24 @@ func (lp *LogPoller) StartListeningForPrices() {
 				lp.logger.Info("log is our own, skiping ...")
 				continue
 			}
-			currentAnswer, err := lp.aggregator.LatestRoundData(nil)
-			if err != nil {
-				lp.logger.Errorf("failed to get latest round data %v", err)
-				continue
-			}
-			nextAnswer, err := lp.timer.FetchData()
+			price, err := lp.timer.FetchData()
 			if err != nil {
 				lp.logger.Errorf("failed to make http request %v", err)
 				continue
 			}
-			next := new(big.Int).SetUint64(uint64(nextAnswer * 100))
-			if diffchecker.CheckDifference(currentAnswer.Answer, next) {
-				lp.logger.WithFields(logrus.Fields{
-					"Current Answer": currentAnswer,
-					"Next Answer":    next,
-				}).Info("Met difference Submitting ...")
-				if err := lp.TrySubmit(0, next); err != nil {
+			if lp.timer.DeviationAllowed(time.Now()) {
+				submitted, err := lp.submitIfDeviated(price, false)
+				if err != nil {
 					lp.logger.Errorf("failed to submit difference %v", err)
 					continue
 				}
+				if submitted {
+					continue
+				}
+			}
+			next, err := lp.toAnswer(price)
+			if err != nil {
+				lp.logger.Errorf("failed to scale answer %v", err)
 				continue
 			}
 			lp.logger.WithFields(logrus.Fields{
@@ -183,100 +292,275 @@ func (lp *LogPoller) StartListeningForPrices() {
 				"Our Address":      lp.walletService.Key.Address,
 			}).Info()
 
-
-			if err := lp.TrySubmit(uint32(newRound.RoundId.Uint64()), next); err != nil {
+			if err := lp.TrySubmit(uint32(newRound.RoundId.Uint64()), next, TriggerRound); err != nil {
 				lp.logger.Errorf("failed to answer %v", err)
 				continue
 			}
-		case head := <-lp.NewHeadCh:
-			query := ethereum.FilterQuery{
-				Addresses: []common.Address{lp.contractAddress},
-				Topics:    [][]common.Hash{lp.eventSignatures},
-				FromBlock: new(big.Int).SetUint64(lp.ReplayFromBlock),
-				ToBlock:   new(big.Int).SetUint64(head),
+		case price := <-lp.timer.PriceChan:
+			if _, err := lp.submitIfDeviated(price, true); err != nil {
+				lp.logger.Errorf("failed to submit difference %v", err)
+				continue
+			}
+		case price := <-lp.timer.IdleChan:
+			lp.logger.WithFields(logrus.Fields{
+				"Answer":    price,
+				"Timestamp": time.Now().UTC(),
+			}).Info("Idle timer fired, submitting ...")
+			next, err := lp.toAnswer(price)
+			if err != nil {
+				lp.logger.Errorf("failed to scale answer %v", err)
+				continue
+			}
+			if err := lp.TrySubmit(0, next, TriggerIdle); err != nil {
+				lp.logger.Errorf("failed to answer after idle period %v", err)
+				continue
 			}
-
 		case price := <-lp.timer.DrumbeatChan:
 			lp.logger.WithFields(logrus.Fields{
 				"Answer":    price,
 				"Timestamp": time.Now().UTC(),
-			}).Info("Received price with 2m interval")
-			nextAnswer, err := lp.timer.FetchData()
+			}).Info("Drumbeat fired, submitting ...")
+			next, err := lp.toAnswer(price)
 			if err != nil {
-				lp.logger.Errorf("failed to make http request %v", err)
+				lp.logger.Errorf("failed to scale answer %v", err)
 				continue
 			}
-			next := new(big.Int).SetUint64(uint64(nextAnswer * 100))
-			if err := lp.TrySubmit(0, next); err != nil {
-				lp.logger.Errorf("failed to answer after 2 min %v", err)
+			if err := lp.TrySubmit(0, next, TriggerDrumbeat); err != nil {
+				lp.logger.Errorf("failed to answer on drumbeat %v", err)
 				continue
 			}
 		}
 	}
 }
 
-func (lp *LogPoller) checkOurNewRoundLog() {
-	query := ethereum.FilterQuery{
-		Addresses: []common.Address{lp.contractAddress},
-		Topics:    [][]common.Hash{lp.eventSignatures},
-		FromBlock: new(big.Int).SetUint64(lp.ReplayFromBlock),
-		ToBlock: nil,
+// toAnswer scales a fetched price into the integer answer the aggregator
+// expects.
+func (lp *LogPoller) toAnswer(price decimal.Decimal) (*big.Int, error) {
+	return scale.ToSubmission(price, lp.decimals, lp.rounding)
+}
+
+// submitIfDeviated submits price when it deviates from the latest on-chain
+// answer by more than the feed thresholds. With sustained the deviation must
+// also pass the feed hysteresis. It reports whether it submitted.
+func (lp *LogPoller) submitIfDeviated(price decimal.Decimal, sustained bool) (bool, error) {
+	next, err := lp.toAnswer(price)
+	if err != nil {
+		return false, fmt.Errorf("failed to scale answer %v", err)
 	}
-	logs, err := lp.client.FilterLogs(context.Background(), query)
+	currentAnswer, err := lp.aggregator.LatestRoundData(nil)
 	if err != nil {
-		errorMsg := fmt.Sprintf("error filter logs reason : %s", err)
-		lp.logger.Errorf(errorMsg)
-		return
+		return false, fmt.Errorf("failed to get latest round data %v", err)
 	}
-	for _, log := range logs {
-		newRound, err := lp.aggregator.ParseNewRound(log)
-		if err != nil {
-			continue
-		}
-		if newRound.StartedBy == lp.walletService.Key.Address {
-			lp.
+	current := decimal.NewFromBigInt(currentAnswer.Answer, 0)
+	deviated := diffchecker.CheckDifference(current, decimal.NewFromBigInt(next, 0), lp.thresholds)
+	if sustained && !lp.observeDeviation(deviated) && deviated {
+		lp.logger.WithFields(logrus.Fields{
+			"Current Answer": currentAnswer.Answer,
+			"Next Answer":    next,
+		}).Debug("Deviation not sustained yet")
+		return false, nil
+	}
+	if !deviated {
+		return false, nil
+	}
+	lp.logger.WithFields(logrus.Fields{
+		"Current Answer": currentAnswer.Answer,
+		"Current Price":  scale.FromSubmission(currentAnswer.Answer, lp.decimals),
+		"Next Answer":    next,
+		"Next Price":     price,
+	}).Info("Met difference Submitting ...")
+	return true, lp.TrySubmit(0, next, TriggerDeviation)
+}
+
+// observeDeviation records a poll in the hysteresis and reports whether the
+// deviation persisted.
+func (lp *LogPoller) observeDeviation(deviated bool) bool {
+	lp.Mu.Lock()
+	defer lp.Mu.Unlock()
+	return lp.hysteresis.Observe(deviated, time.Now())
+}
+
+// checkGuardrails returns an error and raises an alert when answer is
+// blocked by the guardrails of the feed.
+func (lp *LogPoller) checkGuardrails(answer *big.Int) error {
+	var current *big.Int
+	if lp.guardrails.MaxJump != nil {
+		var err error
+		if current, err = lp.aggregator.LatestAnswer(nil); err != nil {
+			return fmt.Errorf("failed to get latest answer %v", err)
 		}
 	}
+	guardrails, err := lp.guardrails.withOverride()
+	if err != nil {
+		lp.logger.Errorf("Ignoring guardrail override %v", err)
+	}
+	if err := guardrails.check(answer, current, time.Now()); err != nil {
+		lp.blocked.Add(1)
+		lp.logger.WithFields(logrus.Fields{
+			"Alert":          "guardrail",
+			"Answer":         answer,
+			"Current Answer": current,
+			"Reason":         err.Error(),
+		}).Error("Guardrail blocked submission")
+		return err
+	}
+	return nil
+}
+
+// GuardrailBlocks returns the number of answers blocked by the guardrails.
+func (lp *LogPoller) GuardrailBlocks() uint64 {
+	return lp.blocked.Load()
+}
+
+// UnderfundedRounds returns the number of rounds skipped because they could
+// not pay for the submission.
+func (lp *LogPoller) UnderfundedRounds() uint64 {
+	return lp.underfunded.Load()
+}
+
+// UnprofitableSubmissions returns the number of submissions deferred because
+// their gas cost exceeded the round payment.
+func (lp *LogPoller) UnprofitableSubmissions() uint64 {
+	return lp.unprofitable.Load()
+}
+
+// checkProfitability returns an error wrapping paymentchecker.ErrUnprofitable
+// when sending the submission data to round costs more gas than the round
+// pays. Deviations and round answers are let through with
+// AlwaysSubmitDeviations.
+func (lp *LogPoller) checkProfitability(round uint32, data []byte, payment *big.Int, trigger Trigger) error {
+	if !lp.profitability.Enabled || (!trigger.heartbeat() && lp.profitability.AlwaysSubmitDeviations) {
+		return nil
+	}
+	gas, err := lp.client.EstimateGas(context.Background(), ethereum.CallMsg{
+		From: lp.walletService.Key.Address,
+		To:   &lp.contractAddress,
+		Data: data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to estimate submission gas %v", err)
+	}
+	gasPrice, err := lp.client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get gas price %v", err)
+	}
+	if paymentchecker.Profitable(payment, lp.profitability.PaymentRate, gas, gasPrice) {
+		return nil
+	}
+	lp.unprofitable.Add(1)
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(gas), gasPrice)
+	lp.logger.WithFields(logrus.Fields{
+		"RoundID":        round,
+		"Trigger":        trigger,
+		"Gas":            gas,
+		"Gas Price":      gasPrice,
+		"Cost":           cost,
+		"Payment Amount": payment,
+	}).Warn("Deferring unprofitable submission")
+	return fmt.Errorf("%w: submission costs %s wei, round pays %s", paymentchecker.ErrUnprofitable, cost, payment)
 }
 
-func (lp *LogPoller) TrySubmit(roundId uint32, answer *big.Int) error {
-	timeNow := time.Now()
-	lp.timer.Ticker1.Stop()
+// TrySubmit submits answer to round roundId, or to the next round when zero,
+// unless the guardrails, payment or profitability checks block it. It returns
+// once the transaction is handed to the tx manager, without waiting for it to
+// be mined.
+func (lp *LogPoller) TrySubmit(roundId uint32, answer *big.Int, trigger Trigger) error {
+	lp.timer.StopIdleTimer()
+	defer lp.timer.ResetIdleTimer()
+	if err := lp.checkGuardrails(answer); err != nil {
+		return err
+	}
 	roundState, err := lp.aggregator.OracleRoundState(nil, lp.walletService.Key.Address, roundId)
 	if err != nil {
 		return fmt.Errorf("failed to get oracle sound state %v", err)
 	}
-	auth, err := bind.NewKeyedTransactorWithChainID(lp.walletService.Key.ToEcdsaPrivKey(), big.NewInt(4090))
-	if err != nil {
-		return fmt.Errorf("failed to create keyed transactor %v", err)
+	if !roundState.EligibleToSubmit {
+		return fmt.Errorf("not eligible to submit tx")
 	}
-	if roundState.EligibleToSubmit {
-		tx, err := lp.aggregator.Submit(auth, new(big.Int).SetUint64(uint64(roundState.RoundId)), answer)
-		if err != nil {
-			return fmt.Errorf("failed to submit %v", err)
-		}
+	if err := paymentchecker.CheckRound(roundState.AvailableFunds, roundState.PaymentAmount, roundState.OracleCount, lp.minPayment); err != nil {
+		lp.underfunded.Add(1)
 		lp.logger.WithFields(logrus.Fields{
-			"Tx":        tx,
-			"Timestamp": time.Now().UTC(),
-		}).Info("Trying to send transaction")
+			"RoundID":         roundState.RoundId,
+			"Available Funds": roundState.AvailableFunds,
+			"Oracle Count":    roundState.OracleCount,
+			"Payment Amount":  roundState.PaymentAmount,
+			"Min Payment":     lp.minPayment,
+		}).Warn("Skipping underfunded round")
+		return err
+	}
+	round := roundState.RoundId
+	lp.Mu.Lock()
+	pending := lp.pendingRound
+	lp.Mu.Unlock()
+	if pending != 0 && pending == round {
+		return fmt.Errorf("submission to round %d already pending", round)
+	}
+	data, err := lp.abi.Pack("submit", new(big.Int).SetUint64(uint64(round)), answer)
+	if err != nil {
+		return fmt.Errorf("failed to pack submission %v", err)
+	}
+	if err := lp.checkProfitability(round, data, roundState.PaymentAmount, trigger); err != nil {
+		return err
+	}
+	lp.Mu.Lock()
+	lp.pendingRound = round
+	lp.Mu.Unlock()
+	tx, err := lp.txManager.Send(context.Background(), txmanager.Request{
+		To:         lp.contractAddress,
+		Data:       data,
+		Superseded: func(ctx context.Context) (bool, error) { return lp.superseded(ctx, round) },
+		OnDone:     func(receipt *types.Receipt, err error) { lp.submitted(round, receipt, err) },
+	})
+	if err != nil {
+		lp.clearPendingRound(round)
+		return fmt.Errorf("failed to submit %v", err)
+	}
+	lp.logger.WithFields(logrus.Fields{
+		"Tx":        tx.Hex(),
+		"RoundID":   round,
+		"Trigger":   trigger,
+		"Timestamp": time.Now().UTC(),
+	}).Info("Trying to send transaction")
+	return nil
+}
 
-		receipt, err := bind.WaitMined(context.Background(), lp.client.EthClient, tx)
-		if err != nil {
-			return fmt.Errorf("failed to wait tx to be mined %v", err)
-		}
+// superseded reports whether round is over, a later round being open to the
+// oracle.
+func (lp *LogPoller) superseded(ctx context.Context, round uint32) (bool, error) {
+	roundState, err := lp.aggregator.OracleRoundState(&bind.CallOpts{Context: ctx}, lp.walletService.Key.Address, 0)
+	if err != nil {
+		return false, fmt.Errorf("failed to get oracle round state %v", err)
+	}
+	return roundState.RoundId > round, nil
+}
 
-		if receipt.Status == 0x1 {
-			lp.logger.WithFields(logrus.Fields{
-				"Receipt":   receipt,
-				"Timestamp": time.Now().UTC(),
-			}).Info("Transaction successfully sent")
-			lp.pollTicker.Reset(30 * time.Second)
-			lp.timer.Ticker1.Reset(2 * time.Minute)
-		}
-	} else {
-		dur := time.Since(timeNow) + 2*time.Minute
-		lp.timer.Ticker1.Reset(dur)
-		return fmt.Errorf("not eligible to submit tx")
+// submitted handles the outcome of the submission to round.
+func (lp *LogPoller) submitted(round uint32, receipt *types.Receipt, err error) {
+	lp.clearPendingRound(round)
+	logger := lp.logger.WithFields(logrus.Fields{
+		"RoundID":   round,
+		"Timestamp": time.Now().UTC(),
+	})
+	if err != nil {
+		logger.Warnf("Gave up submission %v", err)
+		return
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		logger.WithField("Receipt", receipt).Error("Transaction reverted")
+		return
+	}
+	lp.Mu.Lock()
+	// The deviations seen so far were against the replaced answer.
+	lp.hysteresis.Reset()
+	lp.pollTicker.Reset(lp.pollInterval)
+	lp.Mu.Unlock()
+	logger.WithField("Receipt", receipt).Info("Transaction successfully sent")
+}
+
+func (lp *LogPoller) clearPendingRound(round uint32) {
+	lp.Mu.Lock()
+	defer lp.Mu.Unlock()
+	if lp.pendingRound == round {
+		lp.pendingRound = 0
 	}
-	return nil
 }
@@ -1 +1,388 @@
 package logpoller
+
+import (
+	"context"
+	"encoding/json"
+	"erinaceus_data_feeds/client"
+	"erinaceus_data_feeds/config"
+	aggregator "erinaceus_data_feeds/contract"
+	"erinaceus_data_feeds/keys/ethkey"
+	paymentchecker "erinaceus_data_feeds/payment_checker"
+	"erinaceus_data_feeds/services/timer"
+	"erinaceus_data_feeds/services/txmanager"
+	wallet_service "erinaceus_data_feeds/services/wallet"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardrails(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	bounded := guardrails{
+		Guardrails: config.Guardrails{MinPrice: dec("0.1"), MaxPrice: dec("10"), MaxJump: dec("20")},
+		decimals:   2,
+		minAnswer:  big.NewInt(20),
+		maxAnswer:  big.NewInt(900),
+	}
+	overridden := bounded
+	overridden.OverrideUntil = now.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		guardrails guardrails
+		answer     int64
+		current    *big.Int
+		want       string
+	}{
+		{"plausible", bounded, 110, big.NewInt(100), ""},
+		{"zero without bounds", guardrails{}, 0, nil, "price 0 is not positive"},
+		{"negative without bounds", guardrails{}, -1, nil, "price -1 is not positive"},
+		{"negative allowed", guardrails{Guardrails: config.Guardrails{MinPrice: dec("-5")}}, -1, nil, ""},
+		{"zero allowed", guardrails{Guardrails: config.Guardrails{MinPrice: dec("0")}}, 0, nil, ""},
+		{"exact min price", guardrails{Guardrails: config.Guardrails{MinPrice: dec("0.11")}, decimals: 2}, 11, nil, ""},
+		{"below min price", bounded, 9, nil, "price 0.09 is below the minimum price 0.1"},
+		{"above max price", bounded, 1001, nil, "price 10.01 is above the maximum price 10"},
+		{"below aggregator min", bounded, 19, nil, "answer 19 is below the aggregator minimum submission value 20"},
+		{"above aggregator max", bounded, 901, nil, "answer 901 is above the aggregator maximum submission value 900"},
+		{"jump", bounded, 121, big.NewInt(100), "answer 121 jumps 21.00% from the on-chain answer 100, more than 20%"},
+		{"jump down", bounded, 79, big.NewInt(100), "jumps 21.00%"},
+		{"jump without answer", bounded, 500, big.NewInt(0), ""},
+		{"jump overridden", overridden, 500, big.NewInt(100), ""},
+		{"override keeps price bounds", overridden, 1001, big.NewInt(100), "above the maximum price"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.guardrails.check(big.NewInt(tc.answer), tc.current, now)
+			if tc.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrGuardrail)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+
+	expired := overridden
+	expired.OverrideUntil = now
+	assert.ErrorIs(t, expired.check(big.NewInt(500), big.NewInt(100), now), ErrGuardrail)
+}
+
+func dec(value string) *decimal.Decimal {
+	d := decimal.RequireFromString(value)
+	return &d
+}
+
+func TestGuardrailOverrideFile(t *testing.T) {
+	now := time.Now()
+	g := guardrails{Guardrails: config.Guardrails{MaxJump: dec("20"), OverrideFile: filepath.Join(t.TempDir(), "override")}}
+	jump := func(g guardrails) error { return g.check(big.NewInt(500), big.NewInt(100), now) }
+
+	missing, err := g.withOverride()
+	require.NoError(t, err)
+	assert.ErrorIs(t, jump(missing), ErrGuardrail, "no override without the file")
+
+	until := now.Add(time.Hour).UTC().Format(time.RFC3339)
+	require.NoError(t, os.WriteFile(g.OverrideFile, []byte(until+"\n"), 0644))
+	overridden, err := g.withOverride()
+	require.NoError(t, err)
+	assert.NoError(t, jump(overridden))
+
+	require.NoError(t, os.WriteFile(g.OverrideFile, []byte("soon"), 0644))
+	invalid, err := g.withOverride()
+	assert.ErrorContains(t, err, "invalid guardrail override")
+	assert.ErrorIs(t, jump(invalid), ErrGuardrail)
+}
+
+// fakeLogs returns the new round logs of each block filtered.
+type fakeLogs struct {
+	head    uint64
+	rounds  map[uint64]int64
+	queries []ethereum.FilterQuery
+}
+
+func (f *fakeLogs) BlockNumber(ctx context.Context) (uint64, error) {
+	return f.head, nil
+}
+
+func (f *fakeLogs) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	f.queries = append(f.queries, query)
+	var logs []types.Log
+	for block := query.FromBlock.Uint64(); block <= query.ToBlock.Uint64(); block++ {
+		if round, ok := f.rounds[block]; ok {
+			logs = append(logs, newRoundLog(round))
+		}
+	}
+	return logs, nil
+}
+
+func newRoundLog(round int64) types.Log {
+	parsed, _ := abi.JSON(strings.NewReader(aggregator.AggregatorABI))
+	data, _ := parsed.Events["NewRound"].Inputs.NonIndexed().Pack(big.NewInt(1700000000))
+	return types.Log{
+		Topics: []common.Hash{
+			parsed.Events["NewRound"].ID,
+			common.BigToHash(big.NewInt(round)),
+			common.BytesToHash(common.HexToAddress("0x01").Bytes()),
+		},
+		Data: data,
+	}
+}
+
+// fakeNode is a node answering the calls to the aggregator with the results
+// set by method name, and counting the transactions sent to it.
+type fakeNode struct {
+	mu      sync.Mutex
+	results map[string][]interface{}
+	sent    int
+}
+
+func newFakeNode(t *testing.T) (*fakeNode, *ethclient.Client) {
+	parsed, err := abi.JSON(strings.NewReader(aggregator.AggregatorABI))
+	require.NoError(t, err)
+	node := &fakeNode{results: map[string][]interface{}{
+		"latestRound": {big.NewInt(0)},
+	}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		node.mu.Lock()
+		defer node.mu.Unlock()
+		var result interface{}
+		switch req.Method {
+		case "eth_call":
+			var call struct {
+				Input hexutil.Bytes `json:"input"`
+			}
+			if err := json.Unmarshal(req.Params[0], &call); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			method, err := parsed.MethodById(call.Input)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			out, err := method.Outputs.Pack(node.results[method.Name]...)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			result = hexutil.Bytes(out)
+		case "eth_estimateGas":
+			result = hexutil.Uint64(100000)
+		case "eth_gasPrice":
+			result = (*hexutil.Big)(big.NewInt(100))
+		case "eth_blockNumber", "eth_getTransactionCount":
+			result = hexutil.Uint64(1)
+		case "eth_sendRawTransaction":
+			node.sent++
+			result = common.Hash{}
+		default:
+			http.Error(w, "unexpected method "+req.Method, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	ethClient, err := ethclient.Dial(srv.URL)
+	require.NoError(t, err)
+	return node, ethClient
+}
+
+func (n *fakeNode) set(method string, results ...interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.results[method] = results
+}
+
+func (n *fakeNode) sentCount() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.sent
+}
+
+func newPollingLogPoller(t *testing.T, logs *fakeLogs) (*LogPoller, *fakeNode) {
+	parsed, err := abi.JSON(strings.NewReader(aggregator.AggregatorABI))
+	require.NoError(t, err)
+	node, ethClient := newFakeNode(t)
+	contract, err := aggregator.NewAggregator(common.HexToAddress("0x02"), ethClient)
+	require.NoError(t, err)
+	return &LogPoller{
+		logs:            logs,
+		replayFromBlock: 1000000,
+		aggregator:      contract,
+		eventSignatures: []common.Hash{parsed.Events["NewRound"].ID, parsed.Events["AnswerUpdated"].ID},
+		logchanel:       make(chan *aggregator.AggregatorNewRound, 10),
+	}, node
+}
+
+func TestPollLogs(t *testing.T) {
+	logs := &fakeLogs{rounds: map[uint64]int64{1000005: 3, 1000007: 4, 1012000: 4}}
+	lp, _ := newPollingLogPoller(t, logs)
+
+	require.NoError(t, lp.PollLogs(1000010))
+	require.Len(t, logs.queries, 1)
+	assert.Equal(t, big.NewInt(1000000), logs.queries[0].FromBlock)
+	assert.Equal(t, big.NewInt(1000010), logs.queries[0].ToBlock)
+	require.Len(t, lp.logchanel, 1)
+	assert.Equal(t, big.NewInt(4), (<-lp.logchanel).RoundId, "only the latest round")
+
+	require.NoError(t, lp.PollLogs(1000010))
+	assert.Len(t, logs.queries, 1, "no new block")
+
+	require.NoError(t, lp.PollLogs(1012000))
+	require.Len(t, logs.queries, 4)
+	for i, from := range []int64{1000011, 1005011, 1010011} {
+		assert.Equal(t, big.NewInt(from), logs.queries[i+1].FromBlock)
+	}
+	assert.Equal(t, big.NewInt(1012000), logs.queries[3].ToBlock)
+	assert.Empty(t, lp.logchanel, "round 4 already handled")
+}
+
+func TestPollLogsReplaysCurrentRoundOnly(t *testing.T) {
+	logs := &fakeLogs{rounds: map[uint64]int64{1000005: 3, 1006000: 4, 1011000: 5, 1014000: 6}}
+	lp, node := newPollingLogPoller(t, logs)
+	node.set("latestRound", big.NewInt(6))
+
+	require.NoError(t, lp.PollLogs(1014500))
+	assert.Len(t, logs.queries, 3)
+	require.Len(t, lp.logchanel, 1, "rounds over before the latest one are skipped")
+	assert.Equal(t, big.NewInt(6), (<-lp.logchanel).RoundId)
+
+	logs.rounds[1014600] = 7
+	require.NoError(t, lp.PollLogs(1014600))
+	require.Len(t, lp.logchanel, 1)
+	assert.Equal(t, big.NewInt(7), (<-lp.logchanel).RoundId, "a round started since")
+}
+
+// newSubmittingLogPoller returns a log poller of feed submitting through a
+// fake node, whose latest answer is 1.00 and whose round 2 is open to the
+// oracle and pays 10^15 wei out of ample funds.
+func newSubmittingLogPoller(t *testing.T, feed config.Feed) (*LogPoller, *fakeNode) {
+	node, ethClient := newFakeNode(t)
+	node.set("decimals", uint8(2))
+	node.set("minSubmissionValue", big.NewInt(1))
+	node.set("maxSubmissionValue", big.NewInt(1e18))
+	node.set("latestRoundData", big.NewInt(1), big.NewInt(100), big.NewInt(0), big.NewInt(0), big.NewInt(1))
+	node.set("oracleRoundState", true, uint32(2), big.NewInt(100), uint64(0), uint64(0), big.NewInt(1e18), uint8(3), big.NewInt(1e15))
+	key, err := ethkey.NewV2()
+	require.NoError(t, err)
+	wallet := &wallet_service.WalletService{Key: key}
+	nodeClient := &client.Client{EthClient: ethClient}
+
+	feed.Address = "0x0000000000000000000000000000000000000002"
+	feed.Sources = []config.Source{{Name: "static", Type: config.SourceStatic, Value: "1"}}
+	feed.SetDefaults()
+	logger := logrus.NewEntry(logrus.New())
+	feedTimer, err := timer.NewTimerService(feed, timer.SourceDeps{}, logger)
+	require.NoError(t, err)
+	txManager := txmanager.NewTxManager(nodeClient, 4090, config.TxManager{BumpAfterBlocks: 3, BumpPercent: 10}, wallet, logrus.New())
+	lp, err := NewLogPoller(nodeClient, feed, wallet, txManager, feedTimer, logger)
+	require.NoError(t, err)
+	return lp, node
+}
+
+// requireSent waits for n transactions to reach the node.
+func requireSent(t *testing.T, node *fakeNode, n int) {
+	require.Eventually(t, func() bool { return node.sentCount() == n }, time.Second, time.Millisecond)
+}
+
+func TestTrySubmitSkipsUnderfundedRounds(t *testing.T) {
+	lp, node := newSubmittingLogPoller(t, config.DefaultFeed())
+	node.set("oracleRoundState", true, uint32(2), big.NewInt(100), uint64(0), uint64(0), big.NewInt(2e15), uint8(3), big.NewInt(1e15))
+
+	err := lp.TrySubmit(2, big.NewInt(150), TriggerRound)
+	assert.ErrorIs(t, err, paymentchecker.ErrUnderfunded)
+	assert.Equal(t, uint64(1), lp.UnderfundedRounds())
+	assert.Zero(t, lp.pendingRound, "no submission pending")
+	assert.Zero(t, node.sentCount())
+
+	node.set("oracleRoundState", true, uint32(2), big.NewInt(100), uint64(0), uint64(0), big.NewInt(3e15), uint8(3), big.NewInt(1e15))
+	require.NoError(t, lp.TrySubmit(2, big.NewInt(150), TriggerRound))
+	requireSent(t, node, 1)
+	assert.Equal(t, uint64(1), lp.UnderfundedRounds())
+}
+
+func TestTrySubmitDefersUnprofitableHeartbeats(t *testing.T) {
+	tests := []struct {
+		trigger Trigger
+		always  bool
+		sent    bool
+	}{
+		{TriggerIdle, true, false},
+		{TriggerDrumbeat, true, false},
+		{TriggerDeviation, true, true},
+		{TriggerRound, true, true},
+		{TriggerDeviation, false, false},
+		{TriggerRound, false, false},
+	}
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%s always %t", tc.trigger, tc.always), func(t *testing.T) {
+			feed := config.DefaultFeed()
+			feed.Profitability = config.Profitability{Enabled: true, PaymentRate: 1, AlwaysSubmitDeviations: tc.always}
+			lp, node := newSubmittingLogPoller(t, feed)
+			// The submission costs 10^7 wei of gas for a payment of 10^6.
+			node.set("oracleRoundState", true, uint32(2), big.NewInt(100), uint64(0), uint64(0), big.NewInt(1e18), uint8(3), big.NewInt(1e6))
+
+			err := lp.TrySubmit(0, big.NewInt(150), tc.trigger)
+			if tc.sent {
+				require.NoError(t, err)
+				requireSent(t, node, 1)
+				assert.Zero(t, lp.UnprofitableSubmissions())
+				return
+			}
+			assert.ErrorIs(t, err, paymentchecker.ErrUnprofitable)
+			assert.Equal(t, uint64(1), lp.UnprofitableSubmissions())
+			assert.Zero(t, node.sentCount())
+		})
+	}
+}
+
+func TestSubmitIfDeviatedHysteresis(t *testing.T) {
+	feed := config.DefaultFeed()
+	feed.Hysteresis = config.Hysteresis{Observations: 3}
+	price := decimal.RequireFromString("2")
+
+	lp, node := newSubmittingLogPoller(t, feed)
+	for poll := 1; poll < 3; poll++ {
+		submitted, err := lp.submitIfDeviated(price, true)
+		require.NoError(t, err)
+		assert.False(t, submitted, "deviation not sustained at poll %d", poll)
+	}
+	assert.Zero(t, node.sentCount())
+	submitted, err := lp.submitIfDeviated(price, true)
+	require.NoError(t, err)
+	assert.True(t, submitted, "deviation sustained for 3 polls")
+	requireSent(t, node, 1)
+
+	lp, node = newSubmittingLogPoller(t, feed)
+	submitted, err = lp.submitIfDeviated(price, false)
+	require.NoError(t, err)
+	assert.True(t, submitted, "new rounds are answered without hysteresis")
+	requireSent(t, node, 1)
+}
@@ -2,12 +2,34 @@ package main
 
 import (
 	"erinaceus_data_feeds/application"
+	"erinaceus_data_feeds/config"
+	"erinaceus_data_feeds/utils"
+	"flag"
+	"os"
+	"path/filepath"
 
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	app, err := application.NewApplication()
+	useEnvFile := flag.Bool("with-config", false, "Set to true to load environment variables from .env")
+	configPath := flag.String("config", "", "Path to a TOML or YAML configuration file")
+	flag.Parse()
+
+	if *useEnvFile {
+		wd, err := os.Getwd()
+		if err != nil {
+			logrus.Fatalf("failed to get working directory %v", err)
+		}
+		if err := utils.LoadEnv(filepath.Join(wd, "/.env")); err != nil {
+			logrus.Fatalf("failed to set env variables from .env %v", err)
+		}
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		logrus.Fatalf("failed to load configuration : reason %v", err)
+	}
+	app, err := application.NewApplication(cfg)
 	if err != nil {
 		logrus.Fatalf("failed to load application : reason %v", err)
 	}
@@ -1,7 +1,21 @@
 package paymentchecker
 
-import "math/big"
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
 
+// ErrUnderfunded is wrapped by the errors of rounds that cannot pay for a
+// submission.
+var ErrUnderfunded = errors.New("round is underfunded")
+
+// ErrUnprofitable is wrapped by the errors of submissions costing more gas
+// than the round pays.
+var ErrUnprofitable = errors.New("submission is unprofitable")
+
+// SufficientFunds reports whether the aggregator holds enough funds to pay
+// every oracle of a round.
 func SufficientFunds(availableFunds *big.Int, paymentAmount *big.Int, oracleCount uint8) bool {
 	min := big.NewInt(int64(oracleCount))
 	min = min.Mul(min, paymentAmount)
@@ -12,6 +26,27 @@ func SufficientFunds(availableFunds *big.Int, paymentAmount *big.Int, oracleCoun
 // SufficientPayment checks if the available payment is enough to submit an
 // answer. It compares the payment amount on chain with the min payment amount
 // listed in the job / ENV var.
-// func SufficientPayment(payment *big.Int) bool {
-// 	payment.Cmp(c.MinContractPayment.ToInt()) >= 0
-// }
+func SufficientPayment(payment *big.Int, minPayment *big.Int) bool {
+	return payment.Cmp(minPayment) >= 0
+}
+
+// CheckRound returns an error wrapping ErrUnderfunded when a round paying
+// paymentAmount to each of oracleCount oracles out of availableFunds is not
+// worth submitting for minPayment.
+func CheckRound(availableFunds *big.Int, paymentAmount *big.Int, oracleCount uint8, minPayment *big.Int) error {
+	if !SufficientFunds(availableFunds, paymentAmount, oracleCount) {
+		return fmt.Errorf("%w: available funds %s cannot pay %d oracles %s each", ErrUnderfunded, availableFunds, oracleCount, paymentAmount)
+	}
+	if !SufficientPayment(paymentAmount, minPayment) {
+		return fmt.Errorf("%w: round payment %s is below the minimum payment %s", ErrUnderfunded, paymentAmount, minPayment)
+	}
+	return nil
+}
+
+// Profitable reports whether payment, worth paymentRate wei per unit, covers
+// the cost of a submission using gas at gasPrice.
+func Profitable(payment *big.Int, paymentRate float64, gas uint64, gasPrice *big.Int) bool {
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(gas), gasPrice)
+	worth := new(big.Float).Mul(new(big.Float).SetInt(payment), big.NewFloat(paymentRate))
+	return worth.Cmp(new(big.Float).SetInt(cost)) >= 0
+}
@@ -0,0 +1,44 @@
+package paymentchecker
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRound(t *testing.T) {
+	tests := []struct {
+		name           string
+		availableFunds int64
+		paymentAmount  int64
+		oracleCount    uint8
+		minPayment     int64
+		want           string
+	}{
+		{"funded", 300, 100, 3, 100, ""},
+		{"no minimum", 300, 0, 3, 0, ""},
+		{"cannot pay every oracle", 299, 100, 3, 0, "available funds 299 cannot pay 3 oracles 100 each"},
+		{"payment below minimum", 300, 100, 3, 101, "round payment 100 is below the minimum payment 101"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckRound(big.NewInt(tc.availableFunds), big.NewInt(tc.paymentAmount), tc.oracleCount, big.NewInt(tc.minPayment))
+			if tc.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrUnderfunded)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestProfitable(t *testing.T) {
+	gasPrice := big.NewInt(10)
+	assert.True(t, Profitable(big.NewInt(1000), 1, 100, gasPrice))
+	assert.False(t, Profitable(big.NewInt(999), 1, 100, gasPrice))
+	assert.True(t, Profitable(big.NewInt(500), 2, 100, gasPrice))
+	assert.False(t, Profitable(big.NewInt(1000), 0.5, 100, gasPrice))
+	assert.True(t, Profitable(big.NewInt(0), 1, 100, big.NewInt(0)))
+}
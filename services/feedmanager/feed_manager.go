@@ -0,0 +1,140 @@
+package feedmanager
+
+import (
+	"erinaceus_data_feeds/client"
+	"erinaceus_data_feeds/config"
+	logpoller "erinaceus_data_feeds/logPoller"
+	"erinaceus_data_feeds/services/fetcher"
+	"erinaceus_data_feeds/services/timer"
+	"erinaceus_data_feeds/services/txmanager"
+	wallet_service "erinaceus_data_feeds/services/wallet"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Feed is the independent pipeline answering rounds of one aggregator.
+type Feed struct {
+	Name      string
+	Timer     *timer.Timer
+	LogPoller *logpoller.LogPoller
+}
+
+// FeedManager runs one Feed per configured aggregator. All feeds share the
+// client and the wallet of the node.
+type FeedManager struct {
+	Feeds  []*Feed
+	logger *logrus.Logger
+}
+
+func NewFeedManager(client *client.Client, feeds []config.Feed, walletService *wallet_service.WalletService, txManager *txmanager.TxManager, httpFetcher *fetcher.Fetcher, logger *logrus.Logger) (*FeedManager, error) {
+	fm := &FeedManager{logger: logger}
+	for _, feedCfg := range feeds {
+		feedLogger := logger.WithFields(logrus.Fields{
+			"feed":     feedCfg.Name,
+			"contract": feedCfg.ContractAddress().Hex(),
+		})
+		timer, err := timer.NewTimerService(feedCfg, timer.SourceDeps{Client: client, HTTP: httpFetcher}, feedLogger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create timer for feed %s : Err=<%v>", feedCfg.Name, err)
+		}
+		logPoller, err := logpoller.NewLogPoller(client, feedCfg, walletService, txManager, timer, feedLogger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create log poller for feed %s : Err=<%v>", feedCfg.Name, err)
+		}
+		fm.Feeds = append(fm.Feeds, &Feed{
+			Name:      feedCfg.Name,
+			Timer:     timer,
+			LogPoller: logPoller,
+		})
+	}
+	return fm, nil
+}
+
+// LogPollers returns the log poller of every feed, in configuration order.
+func (fm *FeedManager) LogPollers() []*logpoller.LogPoller {
+	logPollers := make([]*logpoller.LogPoller, 0, len(fm.Feeds))
+	for _, feed := range fm.Feeds {
+		logPollers = append(logPollers, feed.LogPoller)
+	}
+	return logPollers
+}
+
+// Start launches the timer, log polling and price loop of every feed.
+func (fm *FeedManager) Start() {
+	for _, feed := range fm.Feeds {
+		fm.logger.WithField("feed", feed.Name).Info("Starting feed")
+		go feed.Timer.Start()
+		go feed.LogPoller.StartPollingLogs()
+		go feed.LogPoller.StartListeningForPrices()
+	}
+}
+
+// FeedStatus is a snapshot of the state of a feed.
+type FeedStatus struct {
+	Name                    string
+	Sources                 []timer.SourceHealth
+	OutlierRejections       map[string]uint64
+	StaleRejections         map[string]uint64
+	GuardrailBlocks         uint64
+	UnderfundedRounds       uint64
+	UnprofitableSubmissions uint64
+}
+
+// Status returns the status of every feed, in configuration order.
+func (fm *FeedManager) Status() []FeedStatus {
+	statuses := make([]FeedStatus, 0, len(fm.Feeds))
+	for _, feed := range fm.Feeds {
+		statuses = append(statuses, FeedStatus{
+			Name:                    feed.Name,
+			Sources:                 feed.Timer.Health(),
+			OutlierRejections:       feed.Timer.OutlierRejections(),
+			StaleRejections:         feed.Timer.StaleRejections(),
+			GuardrailBlocks:         feed.LogPoller.GuardrailBlocks(),
+			UnderfundedRounds:       feed.LogPoller.UnderfundedRounds(),
+			UnprofitableSubmissions: feed.LogPoller.UnprofitableSubmissions(),
+		})
+	}
+	return statuses
+}
+
+// LogStatus logs the health of every source of every feed, so that degrading
+// providers show before a feed stops updating, and the submissions it
+// skipped.
+func (fm *FeedManager) LogStatus() {
+	for _, status := range fm.Status() {
+		if status.GuardrailBlocks > 0 || status.UnderfundedRounds > 0 || status.UnprofitableSubmissions > 0 {
+			fm.logger.WithFields(logrus.Fields{
+				"feed":                    status.Name,
+				"GuardrailBlocks":         status.GuardrailBlocks,
+				"UnderfundedRounds":       status.UnderfundedRounds,
+				"UnprofitableSubmissions": status.UnprofitableSubmissions,
+			}).Warn("Submission status")
+		}
+		for _, source := range status.Sources {
+			fields := logrus.Fields{
+				"feed":                status.Name,
+				"Source":              source.Source,
+				"State":               source.State,
+				"SuccessRate":         fmt.Sprintf("%.2f", source.SuccessRate),
+				"Latency":             source.Latency.String(),
+				"Fetches":             source.Fetches,
+				"Failures":            source.Failures,
+				"ConsecutiveFailures": source.ConsecutiveFailures,
+				"OutlierRejections":   status.OutlierRejections[source.Source],
+				"StaleRejections":     status.StaleRejections[source.Source],
+			}
+			if source.LastError != "" {
+				fields["LastError"] = source.LastError
+				fields["LastErrorAt"] = source.LastErrorAt.Format(time.RFC3339)
+			}
+			entry := fm.logger.WithFields(fields)
+			if source.State != timer.CircuitClosed {
+				entry.Warn("Source status")
+			} else {
+				entry.Info("Source status")
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package feedmanager
+
+import (
+	"context"
+	"encoding/json"
+	"erinaceus_data_feeds/client"
+	"erinaceus_data_feeds/config"
+	aggregator "erinaceus_data_feeds/contract"
+	logpoller "erinaceus_data_feeds/logPoller"
+	"erinaceus_data_feeds/services/timer"
+	wallet_service "erinaceus_data_feeds/services/wallet"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient returns a client of a node answering the aggregator calls
+// made at startup.
+func newTestClient(t *testing.T) *client.Client {
+	parsed, err := abi.JSON(strings.NewReader(aggregator.AggregatorABI))
+	require.NoError(t, err)
+	results := map[string][]interface{}{
+		"decimals":           {uint8(8)},
+		"minSubmissionValue": {big.NewInt(1)},
+		"maxSubmissionValue": {big.NewInt(1e18)},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		var call struct {
+			Input hexutil.Bytes `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "eth_call" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if err := json.Unmarshal(req.Params[0], &call); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		method, err := parsed.MethodById(call.Input)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		out, _ := method.Outputs.Pack(results[method.Name]...)
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": hexutil.Bytes(out)})
+	}))
+	t.Cleanup(srv.Close)
+	ethClient, err := ethclient.Dial(srv.URL)
+	require.NoError(t, err)
+	return &client.Client{EthClient: ethClient}
+}
+
+func testFeed(name string) config.Feed {
+	feed := config.DefaultFeed()
+	feed.Name = name
+	feed.Sources = []config.Source{{Name: "xrp", Type: config.SourceStatic, Value: "0.5"}}
+	return feed
+}
+
+func TestNewFeedManager(t *testing.T) {
+	decimals := uint8(6)
+	usd := testFeed("XRP/USD")
+	eur := testFeed("XRP/EUR")
+	eur.Decimals = &decimals
+	eur.ObservationSource = `
+		xrp     [type=source name="xrp"]
+		xrp_eur [type=multiply times="0.92"]
+		xrp -> xrp_eur
+	`
+	feeds := []config.Feed{usd, eur}
+	for i := range feeds {
+		feeds[i].SetDefaults()
+	}
+
+	start := time.Now()
+	fm, err := NewFeedManager(newTestClient(t), feeds, &wallet_service.WalletService{}, nil, nil, logrus.New())
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second, "feeds start without delay")
+
+	require.Len(t, fm.Feeds, 2)
+	assert.Equal(t, "XRP/USD", fm.Feeds[0].Name)
+	assert.Equal(t, "XRP/EUR", fm.Feeds[1].Name)
+	assert.Equal(t, []*logpoller.LogPoller{fm.Feeds[0].LogPoller, fm.Feeds[1].LogPoller}, fm.LogPollers())
+	assert.NotSame(t, fm.Feeds[0].Timer, fm.Feeds[1].Timer)
+
+	observation, err := fm.Feeds[0].Timer.Observe(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "0.5", observation.Price.String())
+	observation, err = fm.Feeds[1].Timer.Observe(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "0.46", observation.Price.String(), "the pipeline of the feed")
+
+	statuses := fm.Status()
+	require.Len(t, statuses, 2)
+	for i, status := range statuses {
+		assert.Equal(t, fm.Feeds[i].Name, status.Name)
+		require.Len(t, status.Sources, 1)
+		assert.Equal(t, "xrp", status.Sources[0].Source)
+		assert.Equal(t, timer.CircuitClosed, status.Sources[0].State)
+		assert.Zero(t, status.GuardrailBlocks)
+		assert.Zero(t, status.UnderfundedRounds)
+		assert.Zero(t, status.UnprofitableSubmissions)
+	}
+	assert.Equal(t, uint64(1), statuses[0].Sources[0].Fetches)
+	fm.LogStatus()
+}
+
+func TestNewFeedManagerRejectsInvalidFeed(t *testing.T) {
+	feed := testFeed("XRP/EUR")
+	feed.ObservationSource = `eur [type=source name="eur"]`
+	feed.SetDefaults()
+	_, err := NewFeedManager(newTestClient(t), []config.Feed{feed}, &wallet_service.WalletService{}, nil, nil, logrus.New())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create timer for feed XRP/EUR")
+}
@@ -0,0 +1,141 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// call is a fetch whose response is shared by identical requests.
+type call struct {
+	done     chan struct{}
+	body     []byte
+	err      error
+	finished time.Time
+	// interim is the error the fetch would fail with if it stopped now, as
+	// while it waits for the provider or backs off from a failed attempt.
+	interim error
+	// waiters counts the callers waiting for the fetch, which is cancelled
+	// once they all gave up.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// coalescer lets identical requests share one fetch: the ones made while it
+// is in flight, and the ones made within window of its success. The fetch
+// runs detached from the context of its callers, so that a caller giving up
+// does not fail the others, until the last of them gives up.
+type coalescer struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+func newCoalescer(window time.Duration) *coalescer {
+	return &coalescer{window: window, calls: make(map[string]*call)}
+}
+
+// do returns the response of the fetch shared under key, starting fetch when
+// there is none. It stops waiting when ctx is done, with the interim error
+// fetch reported through note if any.
+func (c *coalescer) do(ctx context.Context, key string, fetch func(ctx context.Context, note func(error)) ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	shared, ok := c.calls[key]
+	if ok {
+		select {
+		case <-shared.done:
+			if shared.err == nil && time.Since(shared.finished) < c.window {
+				c.mu.Unlock()
+				return shared.body, nil
+			}
+			ok = false
+		default:
+		}
+	}
+	if !ok {
+		fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		shared = &call{done: make(chan struct{}), cancel: cancel}
+		c.calls[key] = shared
+		go func() {
+			defer cancel()
+			note := func(err error) {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				shared.interim = err
+			}
+			c.run(key, shared, func() ([]byte, error) { return fetch(fetchCtx, note) })
+		}()
+	}
+	shared.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-shared.done:
+		return shared.body, shared.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if shared.waiters--; shared.waiters == 0 {
+			shared.cancel()
+			if c.calls[key] == shared {
+				delete(c.calls, key)
+			}
+		}
+		if shared.interim != nil {
+			return nil, shared.interim
+		}
+		return nil, classify(ctx, ctx.Err())
+	}
+}
+
+func (c *coalescer) run(key string, shared *call, fetch func() ([]byte, error)) {
+	shared.body, shared.err = fetch()
+	shared.finished = time.Now()
+	close(shared.done)
+	if shared.err != nil || c.window <= 0 {
+		c.forget(key, shared)
+	} else {
+		time.AfterFunc(c.window, func() { c.forget(key, shared) })
+	}
+}
+
+func (c *coalescer) forget(key string, shared *call) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls[key] == shared {
+		delete(c.calls, key)
+	}
+}
+
+// requestKey identifies req by its method, URL, headers and body.
+func requestKey(req *http.Request) (string, error) {
+	hash := sha256.New()
+	io.WriteString(hash, req.Method+" "+req.URL.String()+"\n")
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range req.Header[name] {
+			io.WriteString(hash, name+": "+value+"\n")
+		}
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		if _, err := io.Copy(hash, body); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
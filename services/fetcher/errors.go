@@ -0,0 +1,69 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Error kinds of a failed fetch, matched with errors.Is.
+var (
+	// ErrTimeout is returned when an attempt or the whole fetch ran out of time.
+	ErrTimeout = errors.New("request timed out")
+	// ErrNetwork is returned when the request could not be sent or the
+	// response not read.
+	ErrNetwork = errors.New("network error")
+	// ErrStatus is returned for any non-2xx response.
+	ErrStatus = errors.New("unexpected HTTP status")
+	// ErrRateLimited is returned for HTTP 429 responses.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrTooLarge is returned when the response exceeds the size cap.
+	ErrTooLarge = errors.New("response too large")
+	// ErrParse is returned when the response does not hold a price.
+	ErrParse = errors.New("failed to parse response")
+)
+
+// StatusError is a non-2xx response. It matches ErrStatus, and ErrRateLimited
+// for HTTP 429.
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is the delay requested by the Retry-After header, if any.
+	RetryAfter time.Duration
+	// Body is the beginning of the response body.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrStatus || (target == ErrRateLimited && e.StatusCode == http.StatusTooManyRequests)
+}
+
+// kindError tags err with one of the error kinds.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string { return fmt.Sprintf("%v: %v", e.kind, e.err) }
+
+func (e *kindError) Is(target error) bool { return target == e.kind }
+
+func (e *kindError) Unwrap() error { return e.err }
+
+// Parse tags err as a parse failure.
+func Parse(err error) error {
+	return &kindError{kind: ErrParse, err: err}
+}
+
+// retryable reports whether another attempt may succeed after err.
+func retryable(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusTooManyRequests || status.StatusCode >= 500
+	}
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrNetwork)
+}
@@ -0,0 +1,234 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"erinaceus_data_feeds/config"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxErrorBody caps the response body kept in a StatusError.
+const maxErrorBody = 256
+
+// RequestFunc builds the request of one attempt. It is called again for every
+// retry so that signatures and timestamps are fresh.
+type RequestFunc func(ctx context.Context) (*http.Request, error)
+
+// Fetcher is the HTTP client shared by every HTTP price source. It reuses
+// connections, bounds each attempt, retries transient failures with jittered
+// exponential backoff and caps the response size. Requests to a provider are
+// rate limited across every feed, and identical requests share a response.
+type Fetcher struct {
+	client    *http.Client
+	cfg       config.HTTP
+	providers *providers
+	coalescer *coalescer
+}
+
+// New builds a Fetcher with the proxy and TLS settings of cfg.
+func New(cfg config.HTTP) (*Fetcher, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 16
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %v", cfg.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if cfg.CAFile != "" || cfg.CertFile != "" {
+		tlsConfig, err := tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &Fetcher{
+		client:    &http.Client{Transport: transport},
+		cfg:       cfg,
+		providers: newProviders(cfg.RateLimits),
+		coalescer: newCoalescer(cfg.CoalesceWindow.D()),
+	}, nil
+}
+
+func tlsConfig(cfg config.HTTP) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %v", cfg.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Fetch sends the request built by newRequest and returns the response body,
+// which must not be modified as it may be shared with identical requests.
+// Requests signed with a timestamp are never identical. Failed attempts are
+// retried while any caller sharing the request waits; ctx only bounds the
+// wait of this caller. The returned error matches one of the error kinds of
+// this package.
+func (f *Fetcher) Fetch(ctx context.Context, newRequest RequestFunc) ([]byte, error) {
+	req, err := newRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+	return f.coalescer.do(ctx, key, func(ctx context.Context, note func(error)) ([]byte, error) {
+		return f.fetch(ctx, newRequest, note)
+	})
+}
+
+// fetch runs the attempts of a request, noting the error it would fail with
+// while it waits.
+func (f *Fetcher) fetch(ctx context.Context, newRequest RequestFunc, note func(error)) ([]byte, error) {
+	var err error
+	for attempt := 0; ; attempt++ {
+		var body []byte
+		body, err = f.attempt(ctx, newRequest, note)
+		if err == nil {
+			return body, nil
+		}
+		if attempt >= f.cfg.Retries || !retryable(err) || ctx.Err() != nil {
+			break
+		}
+		note(err)
+		timer := time.NewTimer(f.backoff(attempt, err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+	return nil, err
+}
+
+func (f *Fetcher) attempt(ctx context.Context, newRequest RequestFunc, note func(error)) ([]byte, error) {
+	req, err := newRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider := f.providers.get(req)
+	note(&kindError{kind: ErrRateLimited, err: errors.New("waiting for the provider rate limit")})
+	if err := provider.wait(ctx); err != nil {
+		return nil, err
+	}
+	note(nil)
+	ctx, cancel := context.WithTimeout(ctx, f.cfg.RequestTimeout.D())
+	defer cancel()
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, classify(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		status := &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+			Body:       string(body),
+		}
+		if status.RetryAfter > 0 {
+			provider.block(status.RetryAfter)
+		}
+		return nil, status
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.cfg.MaxResponseSize+1))
+	if err != nil {
+		return nil, classify(ctx, err)
+	}
+	if int64(len(body)) > f.cfg.MaxResponseSize {
+		return nil, &kindError{kind: ErrTooLarge, err: fmt.Errorf("body exceeds %d bytes", f.cfg.MaxResponseSize)}
+	}
+	return body, nil
+}
+
+// classify tags a transport error as a timeout or a network error.
+func classify(ctx context.Context, err error) error {
+	var netErr net.Error
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &kindError{kind: ErrTimeout, err: err}
+	}
+	return &kindError{kind: ErrNetwork, err: err}
+}
+
+// backoff returns the delay before the attempt following attempt: a random
+// duration up to RetryBackoff * 2^attempt, capped at MaxRetryBackoff, or the
+// delay requested by a rate limiting server when longer.
+func (f *Fetcher) backoff(attempt int, err error) time.Duration {
+	limit := f.cfg.RetryBackoff.D() << attempt
+	if max := f.cfg.MaxRetryBackoff.D(); limit > max || limit <= 0 {
+		limit = max
+	}
+	var delay time.Duration
+	if limit > 0 {
+		delay = time.Duration(rand.Int63n(int64(limit))) + 1
+	}
+	var status *StatusError
+	if errors.As(err, &status) && status.RetryAfter > delay {
+		delay = status.RetryAfter
+	}
+	return delay
+}
+
+// retryAfter parses a Retry-After header holding seconds or an HTTP date.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(at); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultFetcher *Fetcher
+)
+
+// Default returns a Fetcher with the default HTTP settings, shared by callers
+// that were not given one.
+func Default() *Fetcher {
+	defaultOnce.Do(func() {
+		// The default settings load no files and cannot fail.
+		defaultFetcher, _ = New(config.DefaultHTTP())
+	})
+	return defaultFetcher
+}
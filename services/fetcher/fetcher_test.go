@@ -0,0 +1,252 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"erinaceus_data_feeds/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFetcher(t *testing.T) *Fetcher {
+	t.Helper()
+	cfg := config.DefaultHTTP()
+	cfg.RequestTimeout = config.Duration(100 * time.Millisecond)
+	cfg.RetryBackoff = config.Duration(time.Millisecond)
+	cfg.MaxRetryBackoff = config.Duration(5 * time.Millisecond)
+	cfg.MaxResponseSize = 64
+	f, err := New(cfg)
+	require.NoError(t, err)
+	return f
+}
+
+func get(url string) RequestFunc {
+	return func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	}
+}
+
+func TestFetchRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "<html>bad gateway</html>", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"p":1}`)
+	}))
+	defer srv.Close()
+
+	body, err := newTestFetcher(t).Fetch(context.Background(), get(srv.URL))
+	require.NoError(t, err)
+	assert.Equal(t, `{"p":1}`, string(body))
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestFetchErrorKinds(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.Path {
+		case "/limited":
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		case "/missing":
+			http.Error(w, "not found", http.StatusNotFound)
+		case "/large":
+			fmt.Fprint(w, strings.Repeat("1", 65))
+		case "/slow":
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer srv.Close()
+	f := newTestFetcher(t)
+
+	tests := []struct {
+		path  string
+		kind  error
+		calls int32
+	}{
+		{"/limited", ErrRateLimited, 3},
+		{"/missing", ErrStatus, 1},
+		{"/large", ErrTooLarge, 1},
+		{"/slow", ErrTimeout, 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			calls.Store(0)
+			_, err := f.Fetch(context.Background(), get(srv.URL+tc.path))
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, tc.kind), err.Error())
+			assert.Equal(t, tc.calls, calls.Load())
+		})
+	}
+
+	var status *StatusError
+	_, err := f.Fetch(context.Background(), get(srv.URL+"/missing"))
+	require.True(t, errors.As(err, &status))
+	assert.Equal(t, http.StatusNotFound, status.StatusCode)
+	assert.False(t, errors.Is(err, ErrRateLimited))
+
+	_, err = f.Fetch(context.Background(), get("http://127.0.0.1:1"))
+	assert.True(t, errors.Is(err, ErrNetwork), err.Error())
+}
+
+func TestBackoff(t *testing.T) {
+	f := newTestFetcher(t)
+	for attempt := 0; attempt < 10; attempt++ {
+		delay := f.backoff(attempt, errors.New("failed"))
+		assert.Greater(t, delay, time.Duration(0))
+		assert.LessOrEqual(t, delay, 5*time.Millisecond)
+	}
+	assert.Equal(t, time.Second, f.backoff(0, &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second}))
+	assert.Equal(t, 3*time.Second, retryAfter("3"))
+}
+
+func TestFetchCoalescesIdenticalRequests(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer srv.Close()
+	f := newTestFetcher(t)
+	f.coalescer.window = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, err := f.Fetch(context.Background(), get(srv.URL+"/a"))
+			assert.NoError(t, err)
+			assert.Equal(t, "/a", string(body))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+
+	_, err := f.Fetch(context.Background(), get(srv.URL+"/a"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), calls.Load(), "reused within the window")
+	_, err = f.Fetch(context.Background(), get(srv.URL+"/b"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load(), "other requests are not shared")
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = f.Fetch(context.Background(), get(srv.URL+"/a"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load(), "fetched again after the window")
+}
+
+func TestFetchOutlivesCallersGivingUp(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer srv.Close()
+	f := newTestFetcher(t)
+
+	impatient := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := f.Fetch(ctx, get(srv.URL+"/a"))
+		impatient <- err
+	}()
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	body, err := f.Fetch(context.Background(), get(srv.URL+"/a"))
+	require.NoError(t, err)
+	assert.Equal(t, "/a", string(body))
+	assert.ErrorIs(t, <-impatient, ErrTimeout)
+	assert.Equal(t, int32(1), calls.Load(), "shared with the caller that gave up")
+}
+
+func TestFetchRateLimitsProviders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "1")
+	}))
+	defer srv.Close()
+	cfg := config.DefaultHTTP()
+	cfg.CoalesceWindow = 0
+	cfg.RateLimits = []config.RateLimit{
+		{Host: "127.0.0.1", RequestsPerSecond: 20},
+		{Host: "127.0.0.1", APIKey: "fast", RequestsPerSecond: 1000, Burst: 10},
+	}
+	f, err := New(cfg)
+	require.NoError(t, err)
+
+	fetchN := func(n int, newRequest func(i int) RequestFunc) time.Duration {
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			_, err := f.Fetch(context.Background(), newRequest(i))
+			require.NoError(t, err)
+		}
+		return time.Since(start)
+	}
+	elapsed := fetchN(4, func(i int) RequestFunc { return get(fmt.Sprintf("%s/%d", srv.URL, i)) })
+	assert.GreaterOrEqual(t, elapsed, 140*time.Millisecond, "3 waits of 50ms after the first request")
+
+	elapsed = fetchN(4, func(i int) RequestFunc {
+		return func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/%d", srv.URL, i), nil)
+			if err == nil {
+				req.Header.Set("X-API-Key", "fast")
+			}
+			return req, err
+		}
+	})
+	assert.Less(t, elapsed, 50*time.Millisecond, "the key has its own limit")
+
+	fetchN(1, func(int) RequestFunc { return get(srv.URL + "/now") })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = f.Fetch(ctx, get(srv.URL+"/late"))
+	assert.ErrorIs(t, err, ErrRateLimited, "no token before the deadline")
+}
+
+func TestFetchSharesRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, "1")
+	}))
+	defer srv.Close()
+	f := newTestFetcher(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := f.Fetch(ctx, get(srv.URL+"/a"))
+	assert.ErrorIs(t, err, ErrRateLimited)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = f.Fetch(ctx, get(srv.URL+"/b"))
+	assert.ErrorIs(t, err, ErrRateLimited, "other requests to the provider wait for Retry-After too")
+	assert.Equal(t, int32(1), calls.Load())
+
+	start := time.Now()
+	_, err = f.Fetch(context.Background(), get(srv.URL+"/c"))
+	require.NoError(t, err)
+	assert.Greater(t, time.Since(start), 500*time.Millisecond)
+}
@@ -0,0 +1,130 @@
+package fetcher
+
+import (
+	"context"
+	"erinaceus_data_feeds/config"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// provider holds the rate limit state shared by the requests to a host, or to
+// a host with a given API key.
+type provider struct {
+	// limiter is nil for providers without a configured rate limit.
+	limiter *rate.Limiter
+
+	mu           sync.Mutex
+	blockedUntil time.Time
+}
+
+// wait blocks until the provider accepts another request or ctx is done.
+func (p *provider) wait(ctx context.Context) error {
+	p.mu.Lock()
+	delay := time.Until(p.blockedUntil)
+	p.mu.Unlock()
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return &kindError{kind: ErrRateLimited, err: ctx.Err()}
+		case <-timer.C:
+		}
+	}
+	if p.limiter == nil {
+		return nil
+	}
+	if err := p.limiter.Wait(ctx); err != nil {
+		return &kindError{kind: ErrRateLimited, err: err}
+	}
+	return nil
+}
+
+// block holds back every request to the provider for delay, as asked by a
+// Retry-After header.
+func (p *provider) block(delay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if until := time.Now().Add(delay); until.After(p.blockedUntil) {
+		p.blockedUntil = until
+	}
+}
+
+type providerKey struct {
+	host   string
+	apiKey string
+}
+
+// providers maps requests to their provider.
+type providers struct {
+	limits []config.RateLimit
+
+	mu    sync.Mutex
+	byKey map[providerKey]*provider
+}
+
+func newProviders(limits []config.RateLimit) *providers {
+	return &providers{limits: limits, byKey: make(map[providerKey]*provider)}
+}
+
+// get returns the provider of req. A rate limit naming the API key carried by
+// req takes precedence over one for the whole host.
+func (p *providers) get(req *http.Request) *provider {
+	key := providerKey{host: strings.ToLower(req.URL.Hostname())}
+	var limit *config.RateLimit
+	for i, candidate := range p.limits {
+		if !strings.EqualFold(candidate.Host, key.host) {
+			continue
+		}
+		if candidate.APIKey == "" {
+			if limit == nil {
+				limit = &p.limits[i]
+			}
+		} else if carriesKey(req, candidate.APIKey) {
+			limit = &p.limits[i]
+			key.apiKey = candidate.APIKey
+			break
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if existing, ok := p.byKey[key]; ok {
+		return existing
+	}
+	created := &provider{}
+	if limit != nil {
+		burst := limit.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		created.limiter = rate.NewLimiter(rate.Limit(limit.RequestsPerSecond), burst)
+	}
+	p.byKey[key] = created
+	return created
+}
+
+// carriesKey reports whether apiKey is sent with req, in a header, in the
+// query or as basic auth credentials.
+func carriesKey(req *http.Request, apiKey string) bool {
+	for _, values := range req.Header {
+		for _, value := range values {
+			if value == apiKey || strings.TrimPrefix(value, "Bearer ") == apiKey {
+				return true
+			}
+		}
+	}
+	for _, values := range req.URL.Query() {
+		for _, value := range values {
+			if value == apiKey {
+				return true
+			}
+		}
+	}
+	username, password, ok := req.BasicAuth()
+	return ok && (username == apiKey || password == apiKey)
+}
@@ -0,0 +1,254 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Parse reads an observation source: a graph of tasks in a DOT-like syntax,
+// as used by Chainlink job specs.
+//
+//	ds1    [type=http url="https://example.org/price"];
+//	parse1 [type=jsonparse path="data.price"];
+//	ds1 -> parse1 -> median;
+//	median [type=median];
+//
+// Statements are separated by semicolons or new lines and # or // start a
+// comment. Every task is declared once with its attributes; edges list the
+// tasks whose results feed the next one. The graph must be acyclic and end in
+// a single task whose result is the feed price.
+func Parse(source string) (*Pipeline, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, nodes: make(map[string]*node)}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return build(p.nodes, p.declared, p.edges)
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokString
+	tokArrow
+	tokLBracket
+	tokRBracket
+	tokEquals
+	tokEnd
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	line  int
+	quote bool
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokArrow:
+		return "->"
+	case tokLBracket:
+		return "["
+	case tokRBracket:
+		return "]"
+	case tokEquals:
+		return "="
+	case tokEnd:
+		return "end of statement"
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	line := 1
+	runes := []rune(source)
+	end := func() {
+		if len(tokens) > 0 && tokens[len(tokens)-1].kind != tokEnd {
+			tokens = append(tokens, token{kind: tokEnd, line: line})
+		}
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			// A new line only ends a statement outside of an attribute list.
+			if depth(tokens) == 0 {
+				end()
+			}
+			line++
+		case r == ';':
+			end()
+		case unicode.IsSpace(r):
+		case r == '#' || (r == '/' && i+1 < len(runes) && runes[i+1] == '/'):
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '>':
+			tokens = append(tokens, token{kind: tokArrow, line: line})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{kind: tokLBracket, line: line})
+		case r == ']':
+			tokens = append(tokens, token{kind: tokRBracket, line: line})
+		case r == '=':
+			tokens = append(tokens, token{kind: tokEquals, line: line})
+		case r == ',':
+			// Attributes may be separated by commas as in DOT.
+		case r == '"':
+			var sb strings.Builder
+			start := line
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("line %d: unterminated string", start)
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					sb.WriteRune(runes[i])
+					continue
+				}
+				if runes[i] == '"' {
+					break
+				}
+				if runes[i] == '\n' {
+					line++
+				}
+				sb.WriteRune(runes[i])
+			}
+			tokens = append(tokens, token{kind: tokString, text: sb.String(), line: start, quote: true})
+		default:
+			start := i
+			for i+1 < len(runes) && isBare(runes[i+1]) && !(runes[i+1] == '-' && i+2 < len(runes) && runes[i+2] == '>') {
+				i++
+			}
+			if !isBare(r) {
+				return nil, fmt.Errorf("line %d: unexpected character %q", line, r)
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[start : i+1]), line: line})
+		}
+	}
+	end()
+	return tokens, nil
+}
+
+// depth returns how many attribute lists are open at the end of tokens.
+func depth(tokens []token) int {
+	d := 0
+	for _, t := range tokens {
+		switch t.kind {
+		case tokLBracket:
+			d++
+		case tokRBracket:
+			d--
+		}
+	}
+	return d
+}
+
+func isBare(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-+:/", r)
+}
+
+type parser struct {
+	tokens   []token
+	pos      int
+	nodes    map[string]*node
+	declared []string
+	edges    [][2]string
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) parse() error {
+	for p.pos < len(p.tokens) {
+		if err := p.statement(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) statement() error {
+	first := p.next()
+	if first.kind == tokEnd {
+		return nil
+	}
+	if first.kind != tokIdent || first.quote {
+		return fmt.Errorf("line %d: expected a task name, got %s", first.line, first)
+	}
+	switch p.peek().kind {
+	case tokLBracket:
+		p.next()
+		return p.declaration(first)
+	case tokArrow:
+		return p.edgeChain(first)
+	default:
+		return fmt.Errorf("line %d: expected [ or -> after %s, got %s", first.line, first.text, p.peek())
+	}
+}
+
+func (p *parser) declaration(name token) error {
+	if _, ok := p.nodes[name.text]; ok {
+		return fmt.Errorf("line %d: task %s is declared twice", name.line, name.text)
+	}
+	attrs := make(map[string]string)
+	for {
+		t := p.next()
+		if t.kind == tokRBracket {
+			break
+		}
+		if t.kind != tokIdent {
+			return fmt.Errorf("line %d: expected an attribute of task %s, got %s", t.line, name.text, t)
+		}
+		if eq := p.next(); eq.kind != tokEquals {
+			return fmt.Errorf("line %d: expected = after attribute %s, got %s", eq.line, t.text, eq)
+		}
+		value := p.next()
+		if value.kind != tokIdent && value.kind != tokString {
+			return fmt.Errorf("line %d: expected a value for attribute %s, got %s", value.line, t.text, value)
+		}
+		if _, ok := attrs[t.text]; ok {
+			return fmt.Errorf("line %d: attribute %s of task %s is set twice", t.line, t.text, name.text)
+		}
+		attrs[t.text] = value.text
+	}
+	if end := p.next(); end.kind != tokEnd {
+		return fmt.Errorf("line %d: expected the end of the statement after task %s, got %s", end.line, name.text, end)
+	}
+	p.nodes[name.text] = &node{id: name.text, line: name.line, attrs: attrs}
+	p.declared = append(p.declared, name.text)
+	return nil
+}
+
+func (p *parser) edgeChain(from token) error {
+	for {
+		t := p.next()
+		if t.kind == tokEnd {
+			return nil
+		}
+		if t.kind != tokArrow {
+			return fmt.Errorf("line %d: expected -> after %s, got %s", t.line, from.text, t)
+		}
+		to := p.next()
+		if to.kind != tokIdent || to.quote {
+			return fmt.Errorf("line %d: expected a task name after ->, got %s", to.line, to)
+		}
+		p.edges = append(p.edges, [2]string{from.text, to.text})
+		from = to
+	}
+}
@@ -0,0 +1,246 @@
+package pipeline
+
+import (
+	"context"
+	"erinaceus_data_feeds/services/fetcher"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultTaskTimeout bounds a task that does not set a timeout attribute.
+const DefaultTaskTimeout = 10 * time.Second
+
+// Source is a configured price source a source task reads.
+type Source interface {
+	Fetch(ctx context.Context) (decimal.Decimal, error)
+}
+
+// Deps holds the services the tasks of a run use.
+type Deps struct {
+	// HTTP sends the requests of http tasks, fetcher.Default() when nil.
+	HTTP *fetcher.Fetcher
+	// Sources are the configured sources of the feed, by name.
+	Sources map[string]Source
+}
+
+// Pipeline is a parsed observation source, safe for concurrent runs.
+type Pipeline struct {
+	// nodes is in topological order, the last one is the result.
+	nodes []*node
+}
+
+type node struct {
+	id      string
+	line    int
+	attrs   map[string]string
+	inputs  []*node
+	index   int
+	task    Task
+	timeout time.Duration
+}
+
+// TaskRun is the trace of one task of a run.
+type TaskRun struct {
+	Task     string
+	Type     string
+	Source   string
+	Output   string
+	Err      error
+	Duration time.Duration
+}
+
+// Trace lists the task runs of a pipeline run in execution order.
+type Trace []TaskRun
+
+func build(nodes map[string]*node, declared []string, edges [][2]string) (*Pipeline, error) {
+	if len(declared) == 0 {
+		return nil, fmt.Errorf("observation source has no tasks")
+	}
+	outgoing := make(map[string]int)
+	for _, edge := range edges {
+		from, ok := nodes[edge[0]]
+		if !ok {
+			return nil, fmt.Errorf("task %s is used in an edge but not declared", edge[0])
+		}
+		to, ok := nodes[edge[1]]
+		if !ok {
+			return nil, fmt.Errorf("task %s is used in an edge but not declared", edge[1])
+		}
+		for _, input := range to.inputs {
+			if input == from {
+				return nil, fmt.Errorf("edge %s -> %s is declared twice", from.id, to.id)
+			}
+		}
+		to.inputs = append(to.inputs, from)
+		outgoing[from.id]++
+	}
+
+	var terminals []string
+	for _, id := range declared {
+		n := nodes[id]
+		if outgoing[id] == 0 {
+			terminals = append(terminals, id)
+		}
+		task, err := newTask(n)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: task %s: %v", n.line, n.id, err)
+		}
+		n.task = task
+		n.timeout = DefaultTaskTimeout
+		if timeout, ok := n.attrs["timeout"]; ok {
+			d, err := time.ParseDuration(timeout)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("line %d: task %s: invalid timeout %q", n.line, n.id, timeout)
+			}
+			n.timeout = d
+		}
+	}
+	if len(terminals) != 1 {
+		return nil, fmt.Errorf("observation source must end in a single task, got %s", strings.Join(terminals, ", "))
+	}
+
+	order, err := topologicalOrder(nodes, declared)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{nodes: order}, nil
+}
+
+// topologicalOrder sorts the nodes so that every task follows its inputs,
+// keeping the declaration order where the graph allows it.
+func topologicalOrder(nodes map[string]*node, declared []string) ([]*node, error) {
+	pending := make(map[*node]int)
+	dependents := make(map[*node][]*node)
+	for _, id := range declared {
+		n := nodes[id]
+		pending[n] = len(n.inputs)
+		for _, input := range n.inputs {
+			dependents[input] = append(dependents[input], n)
+		}
+	}
+	var order []*node
+	var ready []*node
+	for _, id := range declared {
+		if pending[nodes[id]] == 0 {
+			ready = append(ready, nodes[id])
+		}
+	}
+	for len(ready) > 0 {
+		n := ready[0]
+		ready = ready[1:]
+		n.index = len(order)
+		order = append(order, n)
+		for _, dependent := range dependents[n] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(order) != len(declared) {
+		var cyclic []string
+		for n, count := range pending {
+			if count > 0 {
+				cyclic = append(cyclic, n.id)
+			}
+		}
+		sort.Strings(cyclic)
+		return nil, fmt.Errorf("observation source has a cycle through %s", strings.Join(cyclic, ", "))
+	}
+	// The single terminal task has no dependents and therefore sorts last.
+	return order, nil
+}
+
+// Sources returns the names of the configured sources read by source tasks.
+func (p *Pipeline) Sources() []string {
+	var names []string
+	for _, n := range p.nodes {
+		if task, ok := n.task.(*sourceTask); ok {
+			names = append(names, task.name)
+		}
+	}
+	return names
+}
+
+// Run executes every task, each as soon as its inputs are done and bounded by
+// its own timeout, and returns the result of the last task with the trace of
+// the run.
+func (p *Pipeline) Run(ctx context.Context, deps Deps) (decimal.Decimal, Trace, error) {
+	if deps.HTTP == nil {
+		deps.HTTP = fetcher.Default()
+	}
+	results := make([]Result, len(p.nodes))
+	trace := make(Trace, len(p.nodes))
+	done := make([]chan struct{}, len(p.nodes))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	for _, n := range p.nodes {
+		go func(n *node) {
+			defer close(done[n.index])
+			inputs := make([]Result, len(n.inputs))
+			for i, input := range n.inputs {
+				<-done[input.index]
+				inputs[i] = results[input.index]
+			}
+			start := time.Now()
+			result := p.runTask(ctx, n, deps, inputs)
+			results[n.index] = result
+			trace[n.index] = TaskRun{
+				Task:     n.id,
+				Type:     n.attrs["type"],
+				Output:   output(result.Value),
+				Err:      result.Err,
+				Duration: time.Since(start),
+			}
+			if task, ok := n.task.(*sourceTask); ok {
+				trace[n.index].Source = task.name
+			}
+		}(n)
+	}
+	last := p.nodes[len(p.nodes)-1]
+	<-done[last.index]
+	// Every task is done once the last one is, as all of them lead to it.
+	result := results[last.index]
+	if result.Err != nil {
+		return decimal.Zero, trace, fmt.Errorf("task %s failed: %v", last.id, result.Err)
+	}
+	price, err := toDecimal(result.Value)
+	if err != nil {
+		return decimal.Zero, trace, fmt.Errorf("task %s: %v", last.id, err)
+	}
+	return price, trace, nil
+}
+
+func (p *Pipeline) runTask(ctx context.Context, n *node, deps Deps, inputs []Result) Result {
+	if !faultTolerant(n.task) {
+		for i, input := range inputs {
+			if input.Err != nil {
+				return Result{Err: fmt.Errorf("input %s failed", n.inputs[i].id)}
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+	value, err := n.task.Run(ctx, deps, inputs)
+	return Result{Value: value, Err: err}
+}
+
+func output(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		const max = 256
+		if len(v) > max {
+			return string(v[:max]) + "..."
+		}
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
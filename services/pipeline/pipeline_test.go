@@ -0,0 +1,158 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticSource string
+
+func (s staticSource) Fetch(context.Context) (decimal.Decimal, error) {
+	return decimal.NewFromString(string(s))
+}
+
+type failingSource struct{}
+
+func (failingSource) Fetch(context.Context) (decimal.Decimal, error) {
+	return decimal.Zero, errors.New("unavailable")
+}
+
+func TestRunCrossRate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"rates":{"EUR":"0.92"}}`)
+	}))
+	defer srv.Close()
+
+	p, err := Parse(fmt.Sprintf(`
+		// XRP/EUR from XRP/USD and USD/EUR
+		usd_eur       [type=http url="%s/latest?base=USD"]
+		usd_eur_parse [type=jsonparse path="rates.EUR"]
+		xrp_usd       [type=source name="xrp"]
+		xrp_eur       [type=multiply]
+
+		usd_eur -> usd_eur_parse -> xrp_eur
+		xrp_usd -> xrp_eur
+	`, srv.URL))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"xrp"}, p.Sources())
+
+	price, trace, err := p.Run(context.Background(), Deps{Sources: map[string]Source{"xrp": staticSource("0.5")}})
+	require.NoError(t, err)
+	assert.Equal(t, "0.46", price.String())
+	require.Len(t, trace, 4)
+	assert.Equal(t, "xrp_eur", trace[3].Task)
+	assert.Equal(t, "0.46", trace[3].Output)
+	for _, run := range trace {
+		assert.NoError(t, run.Err, run.Task)
+	}
+}
+
+func TestRunTransformations(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`a [type=source name="a"]; inv [type=inverse]; a -> inv`, "0.25"},
+		{`a [type=source name="a"]; b [type=source name="b"]; d [type=divide]; a -> d; b -> d`, "0.4"},
+		{`a [type=source name="a"]; d [type=divide by=100]; a -> d`, "0.04"},
+		{`a [type=source name="a"]; m [type=multiply times=1e3]; a -> m`, "4000"},
+		{`a [type=source name="a"]; b [type=source name="b"]; c [type=source name="c"]; m [type=median]; a -> m; b -> m; c -> m`, "10"},
+		{`a [type=source name="a"]; b [type=source name="b"]; m [type=mean]; a -> m; b -> m`, "7"},
+		{`x [type=source name="x"]; y [type=source name="y"]; m [type=median]; x -> m; y -> m`, "0.0000000000000000015"},
+		{`x [type=source name="x"]; y [type=source name="y"]; m [type=mean]; x -> m; y -> m`, "0.0000000000000000015"},
+	}
+	deps := Deps{Sources: map[string]Source{
+		"a": staticSource("4"),
+		"b": staticSource("10"),
+		"c": staticSource("12"),
+		"x": staticSource("0.000000000000000001"),
+		"y": staticSource("0.000000000000000002"),
+	}}
+	for _, tc := range tests {
+		t.Run(tc.source, func(t *testing.T) {
+			p, err := Parse(tc.source)
+			require.NoError(t, err)
+			price, _, err := p.Run(context.Background(), deps)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, price.String())
+		})
+	}
+}
+
+func TestRunFaults(t *testing.T) {
+	deps := Deps{Sources: map[string]Source{"a": staticSource("1"), "b": staticSource("3"), "bad": failingSource{}}}
+
+	p, err := Parse(`
+		a [type=source name="a"]; b [type=source name="b"]; bad [type=source name="bad"]
+		m [type=median]
+		a -> m; b -> m; bad -> m
+	`)
+	require.NoError(t, err)
+	price, trace, err := p.Run(context.Background(), deps)
+	require.NoError(t, err)
+	assert.Equal(t, "2", price.String())
+	assert.EqualError(t, trace[2].Err, "unavailable")
+
+	p, err = Parse(`a [type=source name="a"]; bad [type=source name="bad"]; m [type=median allowedFaults=0]; a -> m; bad -> m`)
+	require.NoError(t, err)
+	_, _, err = p.Run(context.Background(), deps)
+	assert.ErrorContains(t, err, "task m failed: 1 of 2 inputs failed, 0 allowed")
+
+	p, err = Parse(`bad [type=source name="bad"]; m [type=multiply times=2]; bad -> m`)
+	require.NoError(t, err)
+	_, _, err = p.Run(context.Background(), deps)
+	assert.ErrorContains(t, err, "task m failed: input bad failed")
+}
+
+func TestRunTaskTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	p, err := Parse(fmt.Sprintf(`slow [type=http url="%s" timeout="50ms"]; parse [type=jsonparse path="p"]; slow -> parse`, srv.URL))
+	require.NoError(t, err)
+	start := time.Now()
+	_, trace, err := p.Run(context.Background(), Deps{})
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Error(t, trace[0].Err)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{``, "observation source has no tasks"},
+		{`a [type=magic]`, `line 1: task a: unknown type "magic"`},
+		{`a [type=source name="a" url="x"]`, "unknown attribute url for type source"},
+		{`a [type=source name="a"]; a [type=source name="b"]`, "task a is declared twice"},
+		{`a [type=source name="a"]; a -> b`, "task b is used in an edge but not declared"},
+		{`a [type=source name="a"]; b [type=source name="b"]`, "must end in a single task, got a, b"},
+		{`a [type=multiply times=2]; b [type=multiply times=2]; c [type=inverse]; a -> b -> a; a -> c`, "cycle through a, b"},
+		{`a [type=source name="a"]; p [type=jsonparse]; a -> p`, "task p: path must be set"},
+		{`a [type=source name="a" timeout=soon]`, `invalid timeout "soon"`},
+		{`a [type=source name="a`, "unterminated string"},
+		{`a [type=source name="a"]; m [type=median allowedFaults=1]; a -> m`, "allowedFaults must be between 0 and 0"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.source, func(t *testing.T) {
+			_, err := Parse(tc.source)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package pipeline
+
+import (
+	"context"
+	"erinaceus_data_feeds/services/fetcher"
+	"erinaceus_data_feeds/utils/scale"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
+)
+
+// Result is the outcome of one task, the input of the tasks it feeds.
+type Result struct {
+	Value interface{}
+	Err   error
+}
+
+// Task is one step of a pipeline. Numeric results are decimal.Decimal and
+// HTTP responses []byte.
+type Task interface {
+	Run(ctx context.Context, deps Deps, inputs []Result) (interface{}, error)
+}
+
+// aggregateTask is implemented by tasks that accept failed inputs.
+type aggregateTask interface {
+	tolerates()
+}
+
+func faultTolerant(task Task) bool {
+	_, ok := task.(aggregateTask)
+	return ok
+}
+
+func newTask(n *node) (Task, error) {
+	attrs := n.attrs
+	allowed := map[string][]string{
+		"http":      {"url", "method", "body"},
+		"source":    {"name"},
+		"jsonparse": {"path"},
+		"multiply":  {"times"},
+		"divide":    {"by"},
+		"inverse":   {},
+		"median":    {"allowedFaults"},
+		"mean":      {"allowedFaults"},
+	}
+	typ := attrs["type"]
+	names, ok := allowed[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q, expected one of http, source, jsonparse, multiply, divide, inverse, median or mean", typ)
+	}
+	for attr := range attrs {
+		if attr != "type" && attr != "timeout" && !contains(names, attr) {
+			return nil, fmt.Errorf("unknown attribute %s for type %s", attr, typ)
+		}
+	}
+
+	inputs := len(n.inputs)
+	switch typ {
+	case "http":
+		if inputs != 0 {
+			return nil, fmt.Errorf("http takes no inputs, got %d", inputs)
+		}
+		if attrs["url"] == "" {
+			return nil, fmt.Errorf("url must be set")
+		}
+		method := strings.ToUpper(attrs["method"])
+		if method == "" {
+			method = http.MethodGet
+		}
+		return &httpTask{url: attrs["url"], method: method, body: attrs["body"]}, nil
+	case "source":
+		if inputs != 0 {
+			return nil, fmt.Errorf("source takes no inputs, got %d", inputs)
+		}
+		if attrs["name"] == "" {
+			return nil, fmt.Errorf("name must be set")
+		}
+		return &sourceTask{name: attrs["name"]}, nil
+	case "jsonparse":
+		if inputs != 1 {
+			return nil, fmt.Errorf("jsonparse takes one input, got %d", inputs)
+		}
+		if attrs["path"] == "" {
+			return nil, fmt.Errorf("path must be set")
+		}
+		return &jsonParseTask{path: attrs["path"]}, nil
+	case "multiply":
+		task := &multiplyTask{}
+		if times, ok := attrs["times"]; ok {
+			d, err := decimal.NewFromString(times)
+			if err != nil {
+				return nil, fmt.Errorf("times must be a number, got %q", times)
+			}
+			task.times = &d
+		}
+		if task.times != nil && inputs != 1 {
+			return nil, fmt.Errorf("multiply with times takes one input, got %d", inputs)
+		}
+		if task.times == nil && inputs < 2 {
+			return nil, fmt.Errorf("multiply without times takes at least two inputs, got %d", inputs)
+		}
+		return task, nil
+	case "divide":
+		task := &divideTask{}
+		if by, ok := attrs["by"]; ok {
+			d, err := decimal.NewFromString(by)
+			if err != nil || d.IsZero() {
+				return nil, fmt.Errorf("by must be a non-zero number, got %q", by)
+			}
+			task.by = &d
+		}
+		if task.by != nil && inputs != 1 {
+			return nil, fmt.Errorf("divide with by takes one input, got %d", inputs)
+		}
+		if task.by == nil && inputs != 2 {
+			return nil, fmt.Errorf("divide without by takes two inputs, got %d", inputs)
+		}
+		return task, nil
+	case "inverse":
+		if inputs != 1 {
+			return nil, fmt.Errorf("inverse takes one input, got %d", inputs)
+		}
+		return &inverseTask{}, nil
+	default:
+		if inputs == 0 {
+			return nil, fmt.Errorf("%s takes at least one input", typ)
+		}
+		// Like the feed quorum, a majority of the inputs must succeed.
+		allowedFaults := inputs - (inputs/2 + 1)
+		if value, ok := attrs["allowedFaults"]; ok {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || n >= inputs {
+				return nil, fmt.Errorf("allowedFaults must be between 0 and %d, got %q", inputs-1, value)
+			}
+			allowedFaults = n
+		}
+		return &aggregate{mean: typ == "mean", allowedFaults: allowedFaults}, nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type httpTask struct {
+	url    string
+	method string
+	body   string
+}
+
+func (t *httpTask) Run(ctx context.Context, deps Deps, _ []Result) (interface{}, error) {
+	return deps.HTTP.Fetch(ctx, func(ctx context.Context) (*http.Request, error) {
+		var body io.Reader
+		if t.body != "" {
+			body = strings.NewReader(t.body)
+		}
+		req, err := http.NewRequestWithContext(ctx, t.method, t.url, body)
+		if err != nil {
+			return nil, err
+		}
+		if t.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return req, nil
+	})
+}
+
+type sourceTask struct {
+	name string
+}
+
+func (t *sourceTask) Run(ctx context.Context, deps Deps, _ []Result) (interface{}, error) {
+	source, ok := deps.Sources[t.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q", t.name)
+	}
+	return source.Fetch(ctx)
+}
+
+type jsonParseTask struct {
+	path string
+}
+
+func (t *jsonParseTask) Run(_ context.Context, _ Deps, inputs []Result) (interface{}, error) {
+	data, ok := inputs[0].Value.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("input is not a JSON document")
+	}
+	return ExtractPrice(data, t.path)
+}
+
+type multiplyTask struct {
+	times *decimal.Decimal
+}
+
+func (t *multiplyTask) Run(_ context.Context, _ Deps, inputs []Result) (interface{}, error) {
+	values, err := decimals(inputs)
+	if err != nil {
+		return nil, err
+	}
+	product := values[0]
+	for _, value := range values[1:] {
+		product = product.Mul(value)
+	}
+	if t.times != nil {
+		product = product.Mul(*t.times)
+	}
+	return product, nil
+}
+
+type divideTask struct {
+	by *decimal.Decimal
+}
+
+func (t *divideTask) Run(_ context.Context, _ Deps, inputs []Result) (interface{}, error) {
+	values, err := decimals(inputs)
+	if err != nil {
+		return nil, err
+	}
+	divisor := values[len(values)-1]
+	if t.by != nil {
+		divisor = *t.by
+	}
+	if divisor.IsZero() {
+		return nil, fmt.Errorf("division by zero")
+	}
+	return scale.Div(values[0], divisor), nil
+}
+
+type inverseTask struct{}
+
+func (t *inverseTask) Run(_ context.Context, _ Deps, inputs []Result) (interface{}, error) {
+	value, err := toDecimal(inputs[0].Value)
+	if err != nil {
+		return nil, err
+	}
+	if value.IsZero() {
+		return nil, fmt.Errorf("inverse of zero")
+	}
+	return scale.Div(decimal.NewFromInt(1), value), nil
+}
+
+// aggregate is the median or mean task.
+type aggregate struct {
+	mean          bool
+	allowedFaults int
+}
+
+func (t *aggregate) tolerates() {}
+
+func (t *aggregate) Run(_ context.Context, _ Deps, inputs []Result) (interface{}, error) {
+	var values []decimal.Decimal
+	var faults []string
+	for _, input := range inputs {
+		if input.Err != nil {
+			faults = append(faults, input.Err.Error())
+			continue
+		}
+		value, err := toDecimal(input.Value)
+		if err != nil {
+			faults = append(faults, err.Error())
+			continue
+		}
+		values = append(values, value)
+	}
+	if len(faults) > t.allowedFaults {
+		return nil, fmt.Errorf("%d of %d inputs failed, %d allowed: %s", len(faults), len(inputs), t.allowedFaults, strings.Join(faults, "; "))
+	}
+	if t.mean {
+		return scale.Div(decimal.Sum(values[0], values[1:]...), decimal.NewFromInt(int64(len(values)))), nil
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].LessThan(values[j]) })
+	mid := len(values) / 2
+	if len(values)%2 == 1 {
+		return values[mid], nil
+	}
+	return scale.Div(values[mid-1].Add(values[mid]), decimal.NewFromInt(2)), nil
+}
+
+func decimals(inputs []Result) ([]decimal.Decimal, error) {
+	values := make([]decimal.Decimal, len(inputs))
+	for i, input := range inputs {
+		value, err := toDecimal(input.Value)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func toDecimal(value interface{}) (decimal.Decimal, error) {
+	switch v := value.(type) {
+	case decimal.Decimal:
+		return v, nil
+	case []byte:
+		d, err := decimal.NewFromString(strings.TrimSpace(string(v)))
+		if err != nil {
+			return decimal.Zero, fetcher.Parse(fmt.Errorf("input %q is not a number", output(v)))
+		}
+		return d, nil
+	default:
+		return decimal.Zero, fmt.Errorf("input %v is not a number", v)
+	}
+}
+
+// ExtractPrice reads the price at jsonPath of a JSON document.
+func ExtractPrice(data []byte, jsonPath string) (decimal.Decimal, error) {
+	if !gjson.ValidBytes(data) {
+		return decimal.Zero, fetcher.Parse(fmt.Errorf("response is not JSON"))
+	}
+	// Use gjson to parse and extract the value from the JSON dynamically
+	result := gjson.GetBytes(data, jsonPath)
+	if !result.Exists() {
+		return decimal.Zero, fetcher.Parse(fmt.Errorf("failed to extract price using JSONPath: %s", jsonPath))
+	}
+	price, err := ParsePrice(result)
+	if err != nil {
+		return decimal.Zero, fetcher.Parse(err)
+	}
+	return price, nil
+}
+
+// ParsePrice reads a JSON number, or a string holding one, without going
+// through float64 so that no digit of the source value is lost.
+func ParsePrice(result gjson.Result) (decimal.Decimal, error) {
+	switch result.Type {
+	case gjson.Number:
+		return decimal.NewFromString(result.Raw)
+	case gjson.String:
+		return decimal.NewFromString(result.Str)
+	default:
+		return decimal.Zero, fmt.Errorf("value %s is not a number", result.Raw)
+	}
+}
@@ -0,0 +1,43 @@
+package timer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"erinaceus_data_feeds/config"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// authenticate adds the credentials of the auth scheme to req, whose body is
+// body.
+func authenticate(req *http.Request, auth config.Auth, body string, now time.Time) {
+	switch auth.Type {
+	case config.AuthHeader:
+		req.Header.Set(auth.Name, auth.Key)
+	case config.AuthQuery:
+		query := req.URL.Query()
+		query.Set(auth.Name, auth.Key)
+		req.URL.RawQuery = query.Encode()
+	case config.AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+auth.Key)
+	case config.AuthBasic:
+		req.SetBasicAuth(auth.Username, auth.Password)
+	case config.AuthHMAC:
+		timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+		if auth.Key != "" {
+			req.Header.Set(auth.Name, auth.Key)
+		}
+		req.Header.Set(auth.TimestampHeader, timestamp)
+		req.Header.Set(auth.SignatureHeader, Sign(auth.Secret, timestamp, req.Method, req.URL.RequestURI(), body))
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 of timestamp, method, request URI and body
+// concatenated, keyed with secret.
+func Sign(secret, timestamp, method, requestURI, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + method + requestURI + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,99 @@
+package timer
+
+import (
+	"context"
+	"erinaceus_data_feeds/config"
+	"erinaceus_data_feeds/utils/scale"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// DerivedSource computes a cross rate from other sources: the product of the
+// numerator prices divided by the product of the denominator prices. Its quote
+// is as old as its oldest input and fails when any input fails or is older
+// than its max age, which defaults to the one of the derived source.
+type DerivedSource struct {
+	name        string
+	numerator   []timedSource
+	denominator []timedSource
+}
+
+func init() {
+	// Registered here as building the inputs goes through the registry.
+	factories[config.SourceDerived] = newDerivedSource
+}
+
+func newDerivedSource(source config.Source, deps SourceDeps) (PriceSource, error) {
+	d := &DerivedSource{name: source.Name}
+	var err error
+	if d.numerator, err = newInputs(source.Numerator, source.MaxAge, deps); err != nil {
+		return nil, err
+	}
+	if d.denominator, err = newInputs(source.Denominator, source.MaxAge, deps); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func newInputs(sources []config.Source, maxAge config.Duration, deps SourceDeps) ([]timedSource, error) {
+	inputs := make([]timedSource, 0, len(sources))
+	for _, source := range sources {
+		if source.MaxAge == 0 {
+			source.MaxAge = maxAge
+		}
+		input, err := newTimedSource(source, deps)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input %s: %v", source.Name, err)
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+func (d *DerivedSource) Name() string { return d.name }
+
+func (d *DerivedSource) Fetch(ctx context.Context) (decimal.Decimal, error) {
+	quote, err := d.FetchQuote(ctx)
+	return quote.Price, err
+}
+
+// FetchQuote fetches every input concurrently and derives the cross rate.
+func (d *DerivedSource) FetchQuote(ctx context.Context) (Quote, error) {
+	inputs := append(append([]timedSource{}, d.numerator...), d.denominator...)
+	quotes := make([]Quote, len(inputs))
+	errs := make([]error, len(inputs))
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func(i int, input timedSource) {
+			defer wg.Done()
+			quotes[i], errs[i] = input.fetchQuote(ctx)
+		}(i, input)
+	}
+	wg.Wait()
+
+	derived := Quote{Price: decimal.NewFromInt(1), UpdatedAt: time.Now()}
+	denominator := decimal.NewFromInt(1)
+	for i, input := range inputs {
+		if errs[i] != nil {
+			return Quote{}, fmt.Errorf("input %s: %w", input.Name(), errs[i])
+		}
+		quote := quotes[i]
+		if quote.UpdatedAt.Before(derived.UpdatedAt) {
+			derived.UpdatedAt = quote.UpdatedAt
+		}
+		if i < len(d.numerator) {
+			derived.Price = derived.Price.Mul(quote.Price)
+		} else {
+			denominator = denominator.Mul(quote.Price)
+		}
+	}
+	if denominator.IsZero() {
+		return Quote{}, fmt.Errorf("denominator of %s is zero", d.name)
+	}
+	derived.Price = scale.Div(derived.Price, denominator)
+	return derived, nil
+}
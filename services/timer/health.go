@@ -0,0 +1,132 @@
+package timer
+
+import (
+	"erinaceus_data_feeds/config"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCircuitOpen is returned instead of fetching a source whose circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// healthWeight is the weight of the latest fetch in the moving averages of
+// the success rate and latency.
+const healthWeight = 0.1
+
+// SourceHealth is a snapshot of the health of a source.
+type SourceHealth struct {
+	Source string
+	// SuccessRate and Latency are exponential moving averages over the
+	// recent fetches.
+	SuccessRate         float64
+	Latency             time.Duration
+	Fetches             uint64
+	Failures            uint64
+	ConsecutiveFailures int
+	LastError           string
+	LastErrorAt         time.Time
+	LastSuccessAt       time.Time
+	State               string
+}
+
+// sourceHealth tracks the fetches of a source and trips its circuit breaker
+// after repeated failures. Once the cooldown elapsed a single probe is let
+// through: its success closes the breaker, its failure opens it again.
+type sourceHealth struct {
+	breaker config.CircuitBreaker
+	logger  *logrus.Entry
+
+	mu       sync.Mutex
+	health   SourceHealth
+	openedAt time.Time
+	probing  bool
+}
+
+func newSourceHealth(source string, breaker config.CircuitBreaker, logger *logrus.Entry) *sourceHealth {
+	return &sourceHealth{
+		breaker: breaker,
+		logger:  logger,
+		health:  SourceHealth{Source: source, SuccessRate: 1, State: CircuitClosed},
+	}
+}
+
+// allow reports whether the source may be fetched at now, ErrCircuitOpen when
+// it may not.
+func (h *sourceHealth) allow(now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch h.health.State {
+	case CircuitOpen:
+		if now.Sub(h.openedAt) < h.breaker.Cooldown.D() {
+			return ErrCircuitOpen
+		}
+		h.health.State = CircuitHalfOpen
+		h.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if h.probing {
+			return ErrCircuitOpen
+		}
+		h.probing = true
+	}
+	return nil
+}
+
+// record accounts for a fetch that took latency and failed with err, if not
+// nil.
+func (h *sourceHealth) record(now time.Time, latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	health := &h.health
+	health.Fetches++
+	health.Latency += time.Duration(healthWeight * float64(latency-health.Latency))
+	if err == nil {
+		health.SuccessRate += healthWeight * (1 - health.SuccessRate)
+		health.ConsecutiveFailures = 0
+		health.LastSuccessAt = now
+		if health.State != CircuitClosed {
+			h.probing = false
+			health.State = CircuitClosed
+			h.logger.WithField("Source", health.Source).Info("Circuit breaker closed")
+		}
+		return
+	}
+	health.SuccessRate -= healthWeight * health.SuccessRate
+	health.Failures++
+	health.ConsecutiveFailures++
+	health.LastError = err.Error()
+	health.LastErrorAt = now
+	if h.breaker.Disabled {
+		return
+	}
+	if health.State == CircuitHalfOpen || health.ConsecutiveFailures >= h.breaker.FailureThreshold {
+		h.probing = false
+		h.openedAt = now
+		if health.State != CircuitOpen {
+			health.State = CircuitOpen
+			h.logger.WithFields(logrus.Fields{
+				"Source":   health.Source,
+				"Failures": health.ConsecutiveFailures,
+				"Cooldown": h.breaker.Cooldown.String(),
+				"Error":    health.LastError,
+			}).Warn("Circuit breaker opened")
+		}
+	}
+}
+
+func (h *sourceHealth) snapshot() SourceHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.health
+}
@@ -0,0 +1,95 @@
+package timer
+
+import (
+	"context"
+	"erinaceus_data_feeds/config"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// roundClock reads when the on-chain answer was last updated, implemented by
+// the aggregator binding.
+type roundClock interface {
+	LatestTimestamp(opts *bind.CallOpts) (*big.Int, error)
+}
+
+// heartbeat fires the idle timer of a round_age feed once the on-chain answer
+// is older than the idle period. Every oracle arms it from the same
+// AnswerUpdated events, and the age is read again before a heartbeat is sent,
+// so an oracle whose peer already started a round stays quiet.
+type heartbeat struct {
+	period      time.Duration
+	randomDelay time.Duration
+	clock       roundClock
+	timer       *time.Timer
+
+	mu sync.Mutex
+	// updatedAt is the update time of the latest answer seen.
+	updatedAt time.Time
+}
+
+// newHeartbeat returns a heartbeat that fires at once, so that its first
+// check reads the age of the on-chain answer.
+func newHeartbeat(cfg config.IdleTimer, clock roundClock) *heartbeat {
+	return &heartbeat{
+		period:      cfg.Period.D(),
+		randomDelay: cfg.RandomDelay.D(),
+		clock:       clock,
+		timer:       time.NewTimer(0),
+	}
+}
+
+// arm schedules the heartbeat for when an answer updated at updatedAt gets
+// older than the period. Answers older than the latest seen are ignored.
+func (h *heartbeat) arm(updatedAt time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !updatedAt.After(h.updatedAt) {
+		return
+	}
+	h.updatedAt = updatedAt
+	h.reset(time.Until(updatedAt.Add(h.period)))
+}
+
+// due reads the age of the on-chain answer and reports whether a heartbeat
+// must be sent. It re-arms the heartbeat for when the answer gets too old,
+// or for another period when a heartbeat is due so that it is retried if it
+// does not update the answer.
+func (h *heartbeat) due(ctx context.Context) (bool, error) {
+	timestamp, err := h.clock.LatestTimestamp(&bind.CallOpts{Context: ctx})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.reset(h.period)
+		return false, err
+	}
+	// A zero timestamp is a round still waiting for its first answer.
+	if timestamp.Sign() == 0 {
+		h.reset(h.period)
+		return false, nil
+	}
+	if updatedAt := time.Unix(timestamp.Int64(), 0); updatedAt.After(h.updatedAt) {
+		h.updatedAt = updatedAt
+	}
+	if age := time.Since(h.updatedAt); age < h.period {
+		h.reset(h.period - age)
+		return false, nil
+	}
+	h.reset(h.period)
+	return true, nil
+}
+
+func (h *heartbeat) reset(delay time.Duration) {
+	if h.randomDelay > 0 {
+		delay += time.Duration(rand.Int63n(int64(h.randomDelay)))
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	h.timer.Stop()
+	h.timer.Reset(delay)
+}
@@ -0,0 +1,47 @@
+package timer
+
+import (
+	"erinaceus_data_feeds/services/pipeline"
+	"erinaceus_data_feeds/utils/scale"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// SourceResult is the answer of one source to an observation.
+type SourceResult struct {
+	Source string
+	Price  decimal.Decimal
+	// Samples is the number of samples averaged into Price when the feed
+	// samples its sources.
+	Samples int
+	Latency time.Duration
+	Err     error
+}
+
+// Observation is the aggregated answer of every source of a feed.
+type Observation struct {
+	// Price aggregates the answers accepted by the outlier filter.
+	Price    decimal.Decimal
+	Results  []SourceResult
+	Rejected []Rejection
+	// Trace lists the tasks run when the feed has an observation source.
+	Trace pipeline.Trace
+}
+
+// Median returns the median of prices, averaging the two middle values for an
+// even count. It returns zero for an empty slice.
+func Median(prices []decimal.Decimal) decimal.Decimal {
+	if len(prices) == 0 {
+		return decimal.Zero
+	}
+	sorted := make([]decimal.Decimal, len(prices))
+	copy(sorted, prices)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].LessThan(sorted[j]) })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return scale.Div(sorted[mid-1].Add(sorted[mid]), decimal.NewFromInt(2))
+}
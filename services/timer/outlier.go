@@ -0,0 +1,129 @@
+package timer
+
+import (
+	"erinaceus_data_feeds/config"
+	"erinaceus_data_feeds/utils/scale"
+	"fmt"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+var hundred = decimal.NewFromInt(100)
+
+// Rejection records a source answer dropped by the outlier filter.
+type Rejection struct {
+	Source string
+	Price  decimal.Decimal
+	Reason string
+}
+
+// OutlierFilter drops source answers that disagree with the others before
+// they are aggregated into the feed price.
+type OutlierFilter struct {
+	cfg config.OutlierFilter
+}
+
+func NewOutlierFilter(cfg config.OutlierFilter) *OutlierFilter {
+	return &OutlierFilter{cfg: cfg}
+}
+
+// Filter splits results, which must all hold a price, into the accepted ones
+// and the rejected ones with the reason of their rejection.
+func (f *OutlierFilter) Filter(results []SourceResult) ([]SourceResult, []Rejection) {
+	switch f.cfg.Method {
+	case config.OutlierMaxDeviation:
+		return f.maxDeviation(results)
+	case config.OutlierMAD:
+		return f.mad(results)
+	case config.OutlierTrimmedMean:
+		return f.trim(results)
+	default:
+		return results, nil
+	}
+}
+
+// Aggregate turns the accepted prices into the feed price: their mean for the
+// trimmed_mean method and their median otherwise.
+func (f *OutlierFilter) Aggregate(prices []decimal.Decimal) decimal.Decimal {
+	if f.cfg.Method == config.OutlierTrimmedMean && len(prices) > 0 {
+		return scale.Div(decimal.Sum(prices[0], prices[1:]...), decimal.NewFromInt(int64(len(prices))))
+	}
+	return Median(prices)
+}
+
+// maxDeviation rejects prices further than MaxDeviation percent from the
+// median.
+func (f *OutlierFilter) maxDeviation(results []SourceResult) ([]SourceResult, []Rejection) {
+	median := Median(resultPrices(results))
+	if median.IsZero() {
+		return results, nil
+	}
+	limit := decimal.NewFromFloat(f.cfg.MaxDeviation)
+	var accepted []SourceResult
+	var rejected []Rejection
+	for _, result := range results {
+		deviation := scale.Div(result.Price.Sub(median).Abs(), median.Abs()).Mul(hundred)
+		if deviation.GreaterThan(limit) {
+			rejected = append(rejected, Rejection{
+				Source: result.Source,
+				Price:  result.Price,
+				Reason: fmt.Sprintf("deviates %s%% from median %s, limit is %s%%", deviation.StringFixed(2), median, limit),
+			})
+			continue
+		}
+		accepted = append(accepted, result)
+	}
+	return accepted, rejected
+}
+
+// mad rejects prices further from the median than MADMultiplier times the
+// median absolute deviation. When more than half of the prices agree exactly
+// the deviation is zero and every other price is rejected.
+func (f *OutlierFilter) mad(results []SourceResult) ([]SourceResult, []Rejection) {
+	prices := resultPrices(results)
+	median := Median(prices)
+	deviations := make([]decimal.Decimal, len(prices))
+	for i, price := range prices {
+		deviations[i] = price.Sub(median).Abs()
+	}
+	limit := Median(deviations).Mul(decimal.NewFromFloat(f.cfg.MADMultiplier))
+	var accepted []SourceResult
+	var rejected []Rejection
+	for i, result := range results {
+		if deviations[i].GreaterThan(limit) {
+			rejected = append(rejected, Rejection{
+				Source: result.Source,
+				Price:  result.Price,
+				Reason: fmt.Sprintf("deviates %s from median %s, limit is %s", deviations[i], median, limit),
+			})
+			continue
+		}
+		accepted = append(accepted, result)
+	}
+	return accepted, rejected
+}
+
+// trim drops the TrimFraction lowest and highest prices.
+func (f *OutlierFilter) trim(results []SourceResult) ([]SourceResult, []Rejection) {
+	sorted := make([]SourceResult, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Price.LessThan(sorted[j].Price) })
+	n := int(float64(len(sorted)) * f.cfg.TrimFraction)
+	var rejected []Rejection
+	for _, result := range sorted[:n] {
+		rejected = append(rejected, Rejection{Source: result.Source, Price: result.Price, Reason: "trimmed as one of the lowest prices"})
+	}
+	for _, result := range sorted[len(sorted)-n:] {
+		rejected = append(rejected, Rejection{Source: result.Source, Price: result.Price, Reason: "trimmed as one of the highest prices"})
+	}
+	return sorted[n : len(sorted)-n], rejected
+}
+
+func resultPrices(results []SourceResult) []decimal.Decimal {
+	prices := make([]decimal.Decimal, len(results))
+	for i, result := range results {
+		prices[i] = result.Price
+	}
+	return prices
+}
@@ -0,0 +1,163 @@
+package timer
+
+import (
+	"context"
+	"erinaceus_data_feeds/config"
+	"erinaceus_data_feeds/utils/scale"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+type sample struct {
+	at time.Time
+	// updatedAt is when the source last updated the price.
+	updatedAt time.Time
+	price     decimal.Decimal
+	volume    decimal.Decimal
+}
+
+// SampledSource samples a source at a fixed interval into a rolling window
+// and answers with the time or volume weighted average of the window. Failed
+// and stale samples are skipped, so that a brief outage only thins the
+// window. Its quote is as old as the latest sample.
+type SampledSource struct {
+	source     timedSource
+	mode       string
+	interval   time.Duration
+	window     time.Duration
+	minSamples int
+
+	mu      sync.Mutex
+	samples []sample
+	lastErr error
+}
+
+func newSampledSource(source timedSource, cfg config.Sampling) *SampledSource {
+	return &SampledSource{
+		source:     source,
+		mode:       cfg.Mode,
+		interval:   cfg.Interval.D(),
+		window:     cfg.Window.D(),
+		minSamples: cfg.MinSamples,
+	}
+}
+
+func (s *SampledSource) Name() string { return s.source.Name() }
+
+// run samples the source until ctx is done.
+func (s *SampledSource) run(ctx context.Context, logger *logrus.Entry) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sample(ctx); err != nil {
+			logger.WithFields(logrus.Fields{
+				"Source": s.Name(),
+				"Error":  err.Error(),
+			}).Warn("Failed to sample source")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample fetches the source once and adds the answer to the window.
+func (s *SampledSource) Sample(ctx context.Context) error {
+	quote, err := s.source.fetchQuote(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.lastErr = err
+		return err
+	}
+	s.samples = append(s.samples, sample{at: time.Now(), updatedAt: quote.UpdatedAt, price: quote.Price, volume: quote.Volume})
+	return nil
+}
+
+func (s *SampledSource) Fetch(ctx context.Context) (decimal.Decimal, error) {
+	quote, err := s.FetchQuote(ctx)
+	return quote.Price, err
+}
+
+// FetchQuote averages the samples of the window. It fails while the window
+// holds fewer than the minimum number of samples.
+func (s *SampledSource) FetchQuote(context.Context) (Quote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	cutoff := now.Add(-s.window)
+	kept := s.samples[:0]
+	for _, sample := range s.samples {
+		if sample.at.After(cutoff) {
+			kept = append(kept, sample)
+		}
+	}
+	s.samples = kept
+
+	if len(s.samples) < s.minSamples {
+		err := fmt.Errorf("only %d samples in the %s window, need %d", len(s.samples), s.window, s.minSamples)
+		if s.lastErr != nil {
+			err = fmt.Errorf("%v, last sample failed: %w", err, s.lastErr)
+		}
+		return Quote{}, err
+	}
+	quote := Quote{UpdatedAt: s.samples[len(s.samples)-1].updatedAt, Samples: len(s.samples)}
+	for _, sample := range s.samples {
+		quote.Volume = quote.Volume.Add(sample.volume)
+	}
+	if s.mode == config.SamplingVWAP {
+		price, err := vwap(s.samples)
+		if err != nil {
+			return Quote{}, err
+		}
+		quote.Price = price
+	} else {
+		quote.Price = twap(s.samples, now)
+	}
+	return quote, nil
+}
+
+// twap weighs every sample by the time until the next one, or until now for
+// the latest, so that a gap left by an outage is covered by the price seen
+// before it.
+func twap(samples []sample, now time.Time) decimal.Decimal {
+	sum := decimal.Zero
+	total := decimal.Zero
+	for i, sample := range samples {
+		end := now
+		if i+1 < len(samples) {
+			end = samples[i+1].at
+		}
+		weight := decimal.NewFromInt(int64(end.Sub(sample.at)))
+		sum = sum.Add(sample.price.Mul(weight))
+		total = total.Add(weight)
+	}
+	if total.IsZero() {
+		prices := make([]decimal.Decimal, len(samples))
+		for i, sample := range samples {
+			prices[i] = sample.price
+		}
+		return decimal.Avg(prices[0], prices[1:]...)
+	}
+	return scale.Div(sum, total)
+}
+
+// vwap weighs every sample by its volume.
+func vwap(samples []sample) (decimal.Decimal, error) {
+	sum := decimal.Zero
+	volume := decimal.Zero
+	for _, sample := range samples {
+		sum = sum.Add(sample.price.Mul(sample.volume))
+		volume = volume.Add(sample.volume)
+	}
+	if !volume.IsPositive() {
+		return decimal.Zero, fmt.Errorf("no volume reported in the %d samples of the window", len(samples))
+	}
+	return scale.Div(sum, volume), nil
+}
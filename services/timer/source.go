@@ -0,0 +1,248 @@
+package timer
+
+import (
+	"context"
+	"erinaceus_data_feeds/client"
+	"erinaceus_data_feeds/config"
+	aggregator "erinaceus_data_feeds/contract"
+	"erinaceus_data_feeds/services/fetcher"
+	"erinaceus_data_feeds/services/pipeline"
+	"erinaceus_data_feeds/utils/scale"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+)
+
+// PriceSource produces one price of a feed per observation. Fetch is bounded
+// by the source timeout through ctx.
+type PriceSource interface {
+	Name() string
+	Fetch(ctx context.Context) (decimal.Decimal, error)
+}
+
+// Quote is a price with the time it was last updated.
+type Quote struct {
+	Price     decimal.Decimal
+	UpdatedAt time.Time
+	// Volume is the traded volume reported with the price, zero when the
+	// source reports none.
+	Volume decimal.Decimal
+	// Samples is the number of samples averaged into the price of a sampled
+	// source.
+	Samples int
+}
+
+// QuoteSource is implemented by sources that know when their price was last
+// updated. The prices of other sources are taken as updated when fetched.
+type QuoteSource interface {
+	PriceSource
+	FetchQuote(ctx context.Context) (Quote, error)
+}
+
+// FetchQuote fetches the price of source with its update time.
+func FetchQuote(ctx context.Context, source PriceSource) (Quote, error) {
+	if quoteSource, ok := source.(QuoteSource); ok {
+		return quoteSource.FetchQuote(ctx)
+	}
+	price, err := source.Fetch(ctx)
+	if err != nil {
+		return Quote{}, err
+	}
+	return Quote{Price: price, UpdatedAt: time.Now()}, nil
+}
+
+// SourceDeps holds the node services an adapter may use.
+type SourceDeps struct {
+	Client *client.Client
+	// HTTP is the client shared by HTTP sources, fetcher.Default() when nil.
+	HTTP *fetcher.Fetcher
+}
+
+// SourceFactory builds the adapter of a configured source.
+type SourceFactory func(source config.Source, deps SourceDeps) (PriceSource, error)
+
+var (
+	sourcesMu sync.RWMutex
+	factories = map[string]SourceFactory{
+		config.SourceHTTP:       newHTTPSource,
+		config.SourceHTTPPost:   newHTTPSource,
+		config.SourceStatic:     newStaticSource,
+		config.SourceFile:       newFileSource,
+		config.SourceAggregator: newAggregatorSource,
+	}
+)
+
+// RegisterSource makes the adapter built by factory available to sources of
+// the given type. Call it before the feeds are created, typically from an init
+// function. It panics when the type is already registered.
+func RegisterSource(sourceType string, factory SourceFactory) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if _, ok := factories[sourceType]; ok {
+		panic(fmt.Sprintf("price source type %q is already registered", sourceType))
+	}
+	factories[sourceType] = factory
+}
+
+// NewPriceSource builds the adapter registered for the type of source.
+func NewPriceSource(source config.Source, deps SourceDeps) (PriceSource, error) {
+	sourceType := source.Type
+	if sourceType == "" {
+		sourceType = config.SourceHTTP
+	}
+	sourcesMu.RLock()
+	factory, ok := factories[sourceType]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown price source type %q", sourceType)
+	}
+	return factory(source, deps)
+}
+
+func newHTTPSource(source config.Source, deps SourceDeps) (PriceSource, error) {
+	httpFetcher := deps.HTTP
+	if httpFetcher == nil {
+		httpFetcher = fetcher.Default()
+	}
+	return NewAPIRequestDetails(source, httpFetcher), nil
+}
+
+// StaticSource always answers the same price, which is handy on testnets.
+type StaticSource struct {
+	name  string
+	price decimal.Decimal
+}
+
+func newStaticSource(source config.Source, _ SourceDeps) (PriceSource, error) {
+	price, err := decimal.NewFromString(source.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid static price %q: %v", source.Value, err)
+	}
+	return &StaticSource{name: source.Name, price: price}, nil
+}
+
+func (s *StaticSource) Name() string { return s.name }
+
+func (s *StaticSource) Fetch(context.Context) (decimal.Decimal, error) {
+	return s.price, nil
+}
+
+// FileSource reads the price from a file on every observation, so that it
+// can be changed without restarting the node. The file holds either a bare
+// number or JSON read with the source JSON path. The price is as old as the
+// file unless a timestamp JSON path is set.
+type FileSource struct {
+	name          string
+	path          string
+	jsonPath      string
+	timestampPath string
+}
+
+func newFileSource(source config.Source, _ SourceDeps) (PriceSource, error) {
+	return &FileSource{
+		name:          source.Name,
+		path:          source.Path,
+		jsonPath:      source.JSONPath,
+		timestampPath: source.TimestampJSONPath,
+	}, nil
+}
+
+func (s *FileSource) Name() string { return s.name }
+
+func (s *FileSource) Fetch(ctx context.Context) (decimal.Decimal, error) {
+	quote, err := s.FetchQuote(ctx)
+	return quote.Price, err
+}
+
+// FetchQuote reads the price and the time the file was last modified.
+func (s *FileSource) FetchQuote(context.Context) (Quote, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return Quote{}, err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return Quote{}, err
+	}
+	quote := Quote{UpdatedAt: info.ModTime()}
+	if s.jsonPath == "" {
+		if quote.Price, err = decimal.NewFromString(strings.TrimSpace(string(data))); err != nil {
+			return Quote{}, fetcher.Parse(err)
+		}
+		return quote, nil
+	}
+	if quote.Price, err = pipeline.ExtractPrice(data, s.jsonPath); err != nil {
+		return Quote{}, err
+	}
+	if s.timestampPath != "" {
+		if quote.UpdatedAt, err = ExtractTimestamp(data, s.timestampPath); err != nil {
+			return Quote{}, err
+		}
+	}
+	return quote, nil
+}
+
+// AggregatorSource reads the latest answer of another aggregator, scaled back
+// to a price with that aggregator's decimals.
+type AggregatorSource struct {
+	name       string
+	aggregator *aggregator.Aggregator
+
+	mu       sync.Mutex
+	decimals *uint8
+}
+
+func newAggregatorSource(source config.Source, deps SourceDeps) (PriceSource, error) {
+	if deps.Client == nil {
+		return nil, fmt.Errorf("aggregator source %s needs a node client", source.Name)
+	}
+	contract, err := aggregator.NewAggregator(common.HexToAddress(source.Address), deps.Client.EthClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind aggregator %s: %v", source.Address, err)
+	}
+	return &AggregatorSource{name: source.Name, aggregator: contract}, nil
+}
+
+func (s *AggregatorSource) Name() string { return s.name }
+
+func (s *AggregatorSource) Fetch(ctx context.Context) (decimal.Decimal, error) {
+	quote, err := s.FetchQuote(ctx)
+	return quote.Price, err
+}
+
+// FetchQuote returns the latest answer with the time its round was updated.
+func (s *AggregatorSource) FetchQuote(ctx context.Context) (Quote, error) {
+	decimals, err := s.readDecimals(ctx)
+	if err != nil {
+		return Quote{}, err
+	}
+	round, err := s.aggregator.LatestRoundData(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return Quote{}, fmt.Errorf("failed to read latest round data: %v", err)
+	}
+	return Quote{
+		Price:     scale.FromSubmission(round.Answer, decimals),
+		UpdatedAt: time.Unix(round.UpdatedAt.Int64(), 0),
+	}, nil
+}
+
+// readDecimals returns the aggregator decimals, reading them until a read
+// succeeds.
+func (s *AggregatorSource) readDecimals(ctx context.Context) (uint8, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.decimals == nil {
+		decimals, err := s.aggregator.Decimals(&bind.CallOpts{Context: ctx})
+		if err != nil {
+			return 0, fmt.Errorf("failed to read decimals: %v", err)
+		}
+		s.decimals = &decimals
+	}
+	return *s.decimals, nil
+}
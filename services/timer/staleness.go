@@ -0,0 +1,64 @@
+package timer
+
+import (
+	"erinaceus_data_feeds/services/fetcher"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// ErrStale matches the errors of prices last updated longer ago than the max
+// age of their source.
+var ErrStale = errors.New("stale price")
+
+// StaleError reports a price older than the max age of its source.
+type StaleError struct {
+	Age    time.Duration
+	MaxAge time.Duration
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("price is stale: updated %s ago, max age is %s", e.Age.Round(time.Second), e.MaxAge)
+}
+
+func (e *StaleError) Is(target error) bool { return target == ErrStale }
+
+// checkAge fails with a StaleError when quote was updated more than maxAge
+// before now. A zero maxAge disables the check.
+func checkAge(quote Quote, maxAge time.Duration, now time.Time) error {
+	if age := now.Sub(quote.UpdatedAt); maxAge > 0 && age > maxAge {
+		return &StaleError{Age: age, MaxAge: maxAge}
+	}
+	return nil
+}
+
+// millisThreshold separates Unix seconds from Unix milliseconds, which are
+// past it for any date after 1970-04-26.
+const millisThreshold = 1e10
+
+// ExtractTimestamp reads the time at the JSON path of data, written as Unix
+// seconds, Unix milliseconds or an RFC 3339 string.
+func ExtractTimestamp(data []byte, jsonPath string) (time.Time, error) {
+	result := gjson.GetBytes(data, jsonPath)
+	if !result.Exists() {
+		return time.Time{}, fetcher.Parse(fmt.Errorf("failed to extract timestamp using JSONPath: %s", jsonPath))
+	}
+	raw := result.Raw
+	if result.Type == gjson.String {
+		raw = result.Str
+		if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			return t, nil
+		}
+	}
+	unix, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return time.Time{}, fetcher.Parse(fmt.Errorf("timestamp %s is neither a Unix time nor RFC 3339", result.Raw))
+	}
+	if unix > millisThreshold {
+		return time.UnixMilli(int64(unix)), nil
+	}
+	return time.Unix(0, int64(unix*float64(time.Second))), nil
+}
@@ -1,98 +1,370 @@
 package timer
 
 import (
+	"context"
+	"erinaceus_data_feeds/config"
+	aggregator "erinaceus_data_feeds/contract"
+	"erinaceus_data_feeds/services/fetcher"
+	"erinaceus_data_feeds/services/pipeline"
+	"erinaceus_data_feeds/utils/schedule"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
-	"os"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
-	"github.com/tidwall/gjson"
 )
 
-var interval = time.Second * 30
-
-type CustomFormatter struct {
-	logrus.JSONFormatter
+// APIRequestDetails encapsulates details for making API requests. It is the
+// PriceSource of http and http_post sources.
+type APIRequestDetails struct {
+	SourceName string
+	URL        string
+	Method     string
+	Body       string
+	Headers    map[string]string
+	Auth       config.Auth
+	JSONPath   string // JSON path to extract the price
+	// VolumeJSONPath extracts the volume reported with the price, if any.
+	VolumeJSONPath string
+	// TimestampJSONPath extracts the time the price was last updated, if any.
+	TimestampJSONPath string
+	fetcher           *fetcher.Fetcher
 }
 
-func (f *CustomFormatter) Format(entry *logrus.Entry) ([]byte, error) {
-	data, err := f.JSONFormatter.Format(entry)
-	if err != nil {
-		return nil, err
+func NewAPIRequestDetails(source config.Source, httpFetcher *fetcher.Fetcher) *APIRequestDetails {
+	details := &APIRequestDetails{
+		fetcher:           httpFetcher,
+		SourceName:        source.Name,
+		URL:               source.URL,
+		Method:            http.MethodGet,
+		Headers:           source.Headers(),
+		Auth:              source.Auth,
+		JSONPath:          source.JSONPath,
+		VolumeJSONPath:    source.VolumeJSONPath,
+		TimestampJSONPath: source.TimestampJSONPath,
+	}
+	if source.Type == config.SourceHTTPPost {
+		details.Method = http.MethodPost
+		details.Body = source.Body
 	}
-	return append(data, '\n'), nil
+	return details
 }
 
-type PriceResponse struct {
-	Ripple struct {
-		Usd float64 `json:"usd"`
-	} `json:"ripple"`
+func (d *APIRequestDetails) Name() string { return d.SourceName }
+
+// timedSource bounds every fetch of a source by its timeout and rejects
+// prices older than its max age. The fetches of the sources of a feed are
+// tracked by their health, nil for the inputs of other sources.
+type timedSource struct {
+	PriceSource
+	timeout time.Duration
+	maxAge  time.Duration
+	health  *sourceHealth
 }
 
-// APIRequestDetails encapsulates details for making API requests
-type APIRequestDetails struct {
-	URL      string
-	Headers  map[string]string
-	JSONPath string // JSON path to extract the price
+func newTimedSource(source config.Source, deps SourceDeps) (timedSource, error) {
+	priceSource, err := NewPriceSource(source, deps)
+	if err != nil {
+		return timedSource{}, err
+	}
+	timeout := source.Timeout.D()
+	if timeout <= 0 {
+		timeout = config.DefaultSourceTimeout
+	}
+	return timedSource{PriceSource: priceSource, timeout: timeout, maxAge: source.MaxAge.D()}, nil
 }
 
-func NewAPIRequestDetails() *APIRequestDetails {
-	api := os.Getenv("EC_API_URL")
-	header := os.Getenv("EC_API_HEADER_NAME")
-	apiKey := os.Getenv("EC_API_KEY")
+// Fetch returns the price of fetchQuote, so that source tasks of a pipeline
+// get the same checks.
+func (s timedSource) Fetch(ctx context.Context) (decimal.Decimal, error) {
+	quote, err := s.fetchQuote(ctx)
+	return quote.Price, err
+}
 
-	headersMap := make(map[string]string)
-	if header != "" && apiKey != "" {
-		headersMap[header] = apiKey
+func (s timedSource) fetchQuote(ctx context.Context) (Quote, error) {
+	if s.health == nil {
+		return s.fetchFreshQuote(ctx)
 	}
+	start := time.Now()
+	if err := s.health.allow(start); err != nil {
+		return Quote{}, err
+	}
+	quote, err := s.fetchFreshQuote(ctx)
+	s.health.record(time.Now(), time.Since(start), err)
+	return quote, err
+}
 
-	jsonPath := os.Getenv("EC_API_JSON_PATH")
-
-	return &APIRequestDetails{
-		URL:      api,
-		Headers:  headersMap,
-		JSONPath: jsonPath,
+func (s timedSource) fetchFreshQuote(ctx context.Context) (Quote, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	quote, err := FetchQuote(ctx, s.PriceSource)
+	if err != nil {
+		return Quote{}, err
 	}
+	if err := checkAge(quote, s.maxAge, time.Now()); err != nil {
+		return Quote{}, err
+	}
+	return quote, nil
 }
 
 type Timer struct {
-	interval     time.Duration
-	apiDetails   *APIRequestDetails
+	pollTimer    config.Timer
+	idleTimer    config.IdleTimer
+	heartbeat    *heartbeat
+	drumbeat     config.Drumbeat
+	schedule     schedule.Schedule
+	calendar     *schedule.Calendar
+	marketHours  config.MarketHours
+	sources      []timedSource
+	quorum       int
+	outliers     *OutlierFilter
+	samplers     []*SampledSource
+	health       []*sourceHealth
+	pipeline     *pipeline.Pipeline
+	pipelineDeps pipeline.Deps
 	Ticker       *time.Ticker
 	Ticker1      *time.Ticker
-	logger       *logrus.Logger
-	PriceChan    chan float64
-	DrumbeatChan chan float64
-}
-
-func NewTimerService() (*Timer, error) {
-	// interval := os.Getenv("EC_UPDATE_INTERVAL")
-	logger := logrus.New()
-	logger.SetOutput(os.Stdout)
-	logger.SetFormatter(&CustomFormatter{})
-	return &Timer{
-		interval:     interval,
-		Ticker1:      time.NewTicker(2 * time.Minute),
+	drumbeatTick *time.Timer
+	// drumbeatFire fires a drumbeat after its random delay.
+	drumbeatFire *time.Timer
+	rejectionsMu sync.Mutex
+	rejections   map[string]uint64
+	stale        map[string]uint64
+	logger       *logrus.Entry
+	PriceChan    chan decimal.Decimal
+	IdleChan     chan decimal.Decimal
+	DrumbeatChan chan decimal.Decimal
+}
+
+func NewTimerService(feed config.Feed, deps SourceDeps, logger *logrus.Entry) (*Timer, error) {
+	t := &Timer{
+		pollTimer:    feed.PollTimer,
+		idleTimer:    feed.IdleTimer,
+		drumbeat:     feed.Drumbeat,
+		marketHours:  feed.MarketHours,
 		logger:       logger,
-		apiDetails:   NewAPIRequestDetails(),
-		PriceChan:    make(chan float64),
-		DrumbeatChan: make(chan float64),
-	}, nil
+		quorum:       feed.MinResponses(),
+		outliers:     NewOutlierFilter(feed.Outliers),
+		rejections:   make(map[string]uint64),
+		stale:        make(map[string]uint64),
+		PriceChan:    make(chan decimal.Decimal),
+		IdleChan:     make(chan decimal.Decimal),
+		DrumbeatChan: make(chan decimal.Decimal),
+	}
+	for _, source := range feed.AllSources() {
+		timed, err := newTimedSource(source, deps)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source %s: %v", source.Name, err)
+		}
+		timed.health = newSourceHealth(source.Name, feed.CircuitBreaker, logger)
+		t.health = append(t.health, timed.health)
+		if feed.Sampling.Enabled() {
+			// The samples are tracked rather than the reads of the window.
+			sampler := newSampledSource(timed, feed.Sampling)
+			t.samplers = append(t.samplers, sampler)
+			timed.PriceSource = sampler
+			timed.health = nil
+		}
+		t.sources = append(t.sources, timed)
+	}
+	if feed.ObservationSource != "" {
+		if err := t.setPipeline(feed.ObservationSource, deps); err != nil {
+			return nil, fmt.Errorf("invalid observation source: %v", err)
+		}
+	}
+	if !feed.PollTimer.Disabled {
+		t.Ticker = time.NewTicker(feed.PollTimer.Period.D())
+	}
+	if !feed.IdleTimer.Disabled {
+		if feed.IdleTimer.Mode == config.IdleTimerRoundAge {
+			if deps.Client == nil {
+				return nil, fmt.Errorf("round_age idle timer needs a node client")
+			}
+			contract, err := aggregator.NewAggregator(feed.ContractAddress(), deps.Client.EthClient)
+			if err != nil {
+				return nil, fmt.Errorf("failed to bind aggregator %s: %v", feed.Address, err)
+			}
+			t.heartbeat = newHeartbeat(feed.IdleTimer, contract)
+		} else {
+			t.Ticker1 = time.NewTicker(feed.IdleTimer.Period.D())
+		}
+	}
+	if feed.Drumbeat.Enabled {
+		drumbeat, err := feed.Drumbeat.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("invalid drumbeat schedule %v", err)
+		}
+		t.schedule = drumbeat
+		t.drumbeatTick = time.NewTimer(0)
+		t.drumbeatTick.Stop()
+		t.drumbeatFire = time.NewTimer(0)
+		t.drumbeatFire.Stop()
+		t.scheduleDrumbeat(time.Now())
+	}
+	calendar, err := feed.MarketHours.Calendar()
+	if err != nil {
+		return nil, fmt.Errorf("invalid market hours %v", err)
+	}
+	t.calendar = calendar
+	return t, nil
+}
+
+// scheduleDrumbeat arms the drumbeat for its next activation after now. A
+// schedule that never activates again leaves it stopped.
+func (t *Timer) scheduleDrumbeat(now time.Time) {
+	next := t.schedule.Next(now)
+	if next.IsZero() {
+		t.logger.WithField("Schedule", t.drumbeat.Schedule).Warn("Drumbeat schedule never fires again")
+		return
+	}
+	t.drumbeatTick.Reset(next.Sub(now))
+}
+
+// MarketOpen reports whether now falls in the trading sessions of the feed,
+// always true without market hours.
+func (t *Timer) MarketOpen(now time.Time) bool {
+	return t.calendar == nil || t.calendar.IsOpen(now)
+}
+
+// DeviationAllowed reports whether deviations are submitted at now: in the
+// trading sessions, or at any time with DeviationOutsideHours.
+func (t *Timer) DeviationAllowed(now time.Time) bool {
+	return t.MarketOpen(now) || t.marketHours.DeviationOutsideHours
+}
+
+// tickerC returns the channel of ticker, or nil for a disabled ticker so that
+// selecting on it blocks forever.
+func tickerC(ticker *time.Ticker) <-chan time.Time {
+	if ticker == nil {
+		return nil
+	}
+	return ticker.C
+}
+
+// timerC is tickerC for timers.
+func timerC(timer *time.Timer) <-chan time.Time {
+	if timer == nil {
+		return nil
+	}
+	return timer.C
+}
+
+// heartbeatC returns the channel of the heartbeat, nil when the feed has none.
+func heartbeatC(h *heartbeat) <-chan time.Time {
+	if h == nil {
+		return nil
+	}
+	return h.timer.C
+}
+
+// ArmHeartbeat re-arms the round_age idle timer from an answer updated at
+// updatedAt, as read from an AnswerUpdated event. It does nothing for other
+// idle timers.
+func (t *Timer) ArmHeartbeat(updatedAt time.Time) {
+	if t.heartbeat != nil {
+		t.heartbeat.arm(updatedAt)
+	}
+}
+
+// StopIdleTimer pauses the idle timer while a submission is in flight.
+func (t *Timer) StopIdleTimer() {
+	if t.Ticker1 != nil {
+		t.Ticker1.Stop()
+	}
+}
+
+// ResetIdleTimer restarts the idle period after the feed was answered.
+func (t *Timer) ResetIdleTimer() {
+	if t.Ticker1 != nil {
+		t.Ticker1.Reset(t.idleTimer.Period.D())
+	}
 }
 
 func (t *Timer) Start() {
 	t.logger.WithFields(logrus.Fields{
-		"Timestamp":      time.Now().UTC(),
-		"Timer Interval": t.interval.String(),
+		"Timestamp":         time.Now().UTC(),
+		"Poll Timer":        t.pollTimer.Period.String(),
+		"Poll Disabled":     t.pollTimer.Disabled,
+		"Idle Timer":        t.idleTimer.Period.String(),
+		"Idle Disabled":     t.idleTimer.Disabled,
+		"Idle Mode":         t.idleTimer.Mode,
+		"Drumbeat Schedule": t.drumbeat.Schedule,
+		"Drumbeat Enabled":  t.drumbeat.Enabled,
+		"Market Hours":      t.marketHours.Enabled,
 	}).Info("Starting Timer Service")
+	for _, sampler := range t.samplers {
+		go sampler.run(context.Background(), t.logger)
+	}
 	for {
 		select {
-		case <-t.Ticker1.C:
+		case now := <-tickerC(t.Ticker):
+			if !t.DeviationAllowed(now) {
+				t.logger.Debug("Market closed, skipping deviation check")
+				continue
+			}
+			resp, err := t.FetchData()
+			if err != nil {
+				t.logger.Errorf("failed to make http request %v", err)
+				continue
+			}
+			t.PriceChan <- resp
+		case now := <-tickerC(t.Ticker1):
+			if !t.MarketOpen(now) {
+				t.logger.Debug("Market closed, skipping idle timer")
+				continue
+			}
 			resp, err := t.FetchData()
 			if err != nil {
-				logrus.Errorf("failed to make http request %v", err)
+				t.logger.Errorf("failed to make http request %v", err)
+				continue
+			}
+			t.IdleChan <- resp
+		case <-heartbeatC(t.heartbeat):
+			due, err := t.heartbeat.due(context.Background())
+			if err != nil {
+				t.logger.Errorf("failed to read the on-chain answer age %v", err)
+				continue
+			}
+			if !due {
+				continue
+			}
+			if !t.MarketOpen(time.Now()) {
+				t.logger.Debug("Market closed, skipping idle timer")
+				continue
+			}
+			resp, err := t.FetchData()
+			if err != nil {
+				t.logger.Errorf("failed to make http request %v", err)
+				continue
+			}
+			t.IdleChan <- resp
+		case now := <-timerC(t.drumbeatTick):
+			t.scheduleDrumbeat(now)
+			if !t.MarketOpen(now) {
+				t.logger.Debug("Market closed, skipping drumbeat")
+				continue
+			}
+			if delay := t.drumbeat.RandomDelay.D(); delay > 0 {
+				// Delayed off the loop, so that polls go on meanwhile.
+				t.drumbeatFire.Reset(time.Duration(rand.Int63n(int64(delay))))
+				continue
+			}
+			resp, err := t.FetchData()
+			if err != nil {
+				t.logger.Errorf("failed to make http request %v", err)
+				continue
+			}
+			t.DrumbeatChan <- resp
+		case <-timerC(t.drumbeatFire):
+			resp, err := t.FetchData()
+			if err != nil {
+				t.logger.Errorf("failed to make http request %v", err)
 				continue
 			}
 			t.DrumbeatChan <- resp
@@ -100,57 +372,242 @@ func (t *Timer) Start() {
 	}
 }
 
-func (t *Timer) FetchData() (float64, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", t.apiDetails.URL, nil)
+// FetchData observes every source and returns their aggregated price.
+func (t *Timer) FetchData() (decimal.Decimal, error) {
+	observation, err := t.Observe(context.Background())
 	if err != nil {
-		return 0.0, err
+		return decimal.Zero, err
 	}
+	return observation.Price, nil
+}
 
-	// Add headers to the request
-	for key, value := range t.apiDetails.Headers {
-		req.Header.Add(key, value)
+func (t *Timer) setPipeline(observationSource string, deps SourceDeps) error {
+	p, err := pipeline.Parse(observationSource)
+	if err != nil {
+		return err
 	}
+	sources := make(map[string]pipeline.Source)
+	for _, source := range t.sources {
+		sources[source.Name()] = source
+	}
+	for _, name := range p.Sources() {
+		if _, ok := sources[name]; !ok {
+			return fmt.Errorf("source task reads unknown source %q", name)
+		}
+	}
+	t.pipeline = p
+	t.pipelineDeps = pipeline.Deps{HTTP: deps.HTTP, Sources: sources}
+	return nil
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0.0, err
+// Observe fetches every source concurrently, each bounded by its own timeout,
+// drops outliers and aggregates the remaining answers. It fails when fewer
+// sources than the quorum answer or survive the outlier filter.
+func (t *Timer) Observe(ctx context.Context) (*Observation, error) {
+	if t.pipeline != nil {
+		return t.runPipeline(ctx)
 	}
-	defer resp.Body.Close()
+	results := make([]SourceResult, len(t.sources))
+	var wg sync.WaitGroup
+	for i, source := range t.sources {
+		wg.Add(1)
+		go func(i int, source timedSource) {
+			defer wg.Done()
+			results[i] = t.fetchSource(ctx, source)
+		}(i, source)
+	}
+	wg.Wait()
+
+	observation := &Observation{Results: results}
+	var answered []SourceResult
+	for _, result := range results {
+		fields := logrus.Fields{
+			"Source":  result.Source,
+			"Latency": result.Latency.String(),
+		}
+		if errors.Is(result.Err, ErrCircuitOpen) {
+			t.logger.WithFields(fields).Debug("Skipped source with an open circuit breaker")
+			continue
+		}
+		if errors.Is(result.Err, ErrStale) {
+			fields["Error"] = result.Err.Error()
+			fields["Rejections"] = t.count(t.stale, result.Source)
+			t.logger.WithFields(fields).Warn("Rejected stale price")
+			continue
+		}
+		if result.Err != nil {
+			fields["Error"] = result.Err.Error()
+			t.logger.WithFields(fields).Warn("Source failed to answer")
+			continue
+		}
+		fields["Price"] = result.Price
+		if result.Samples > 0 {
+			fields["Samples"] = result.Samples
+		}
+		t.logger.WithFields(fields).Info("Source answered")
+		answered = append(answered, result)
+	}
+	if len(answered) < t.quorum {
+		return nil, fmt.Errorf("only %d of %d sources answered, quorum is %d", len(answered), len(t.sources), t.quorum)
+	}
+
+	accepted, rejected := t.outliers.Filter(answered)
+	observation.Rejected = rejected
+	for _, rejection := range rejected {
+		count := t.count(t.rejections, rejection.Source)
+		t.logger.WithFields(logrus.Fields{
+			"Source":     rejection.Source,
+			"Price":      rejection.Price,
+			"Reason":     rejection.Reason,
+			"Rejections": count,
+		}).Warn("Rejected outlier")
+	}
+	if len(accepted) < t.quorum {
+		return nil, fmt.Errorf("only %d of %d sources passed the outlier filter, quorum is %d", len(accepted), len(t.sources), t.quorum)
+	}
+
+	observation.Price = t.outliers.Aggregate(resultPrices(accepted))
+	t.logger.WithFields(logrus.Fields{
+		"Price":     observation.Price,
+		"Responses": len(answered),
+		"Accepted":  len(accepted),
+		"Sources":   len(t.sources),
+	}).Info("Observed price")
+	return observation, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// runPipeline observes the price with the observation source of the feed and
+// logs the trace of the run.
+func (t *Timer) runPipeline(ctx context.Context) (*Observation, error) {
+	price, trace, err := t.pipeline.Run(ctx, t.pipelineDeps)
+	for _, run := range trace {
+		fields := logrus.Fields{
+			"Task":     run.Task,
+			"Type":     run.Type,
+			"Duration": run.Duration.String(),
+		}
+		if run.Source != "" && errors.Is(run.Err, ErrStale) {
+			fields["Error"] = run.Err.Error()
+			fields["Rejections"] = t.count(t.stale, run.Source)
+			t.logger.WithFields(fields).Warn("Rejected stale price")
+			continue
+		}
+		if run.Err != nil {
+			fields["Error"] = run.Err.Error()
+			t.logger.WithFields(fields).Warn("Pipeline task failed")
+			continue
+		}
+		fields["Output"] = run.Output
+		t.logger.WithFields(fields).Debug("Pipeline task ran")
+	}
 	if err != nil {
-		return 0.0, err
+		return nil, err
 	}
+	t.logger.WithFields(logrus.Fields{
+		"Price": price,
+		"Tasks": len(trace),
+	}).Info("Observed price")
+	return &Observation{Price: price, Trace: trace}, nil
+}
+
+func (t *Timer) count(counts map[string]uint64, source string) uint64 {
+	t.rejectionsMu.Lock()
+	defer t.rejectionsMu.Unlock()
+	counts[source]++
+	return counts[source]
+}
+
+func (t *Timer) counts(counts map[string]uint64) map[string]uint64 {
+	t.rejectionsMu.Lock()
+	defer t.rejectionsMu.Unlock()
+	copied := make(map[string]uint64, len(counts))
+	for source, count := range counts {
+		copied[source] = count
+	}
+	return copied
+}
+
+// OutlierRejections returns how many times each source was rejected by the
+// outlier filter since the timer started.
+func (t *Timer) OutlierRejections() map[string]uint64 {
+	return t.counts(t.rejections)
+}
+
+// Health returns the health of every source of the feed, in configuration
+// order.
+func (t *Timer) Health() []SourceHealth {
+	health := make([]SourceHealth, 0, len(t.health))
+	for _, h := range t.health {
+		health = append(health, h.snapshot())
+	}
+	return health
+}
+
+// StaleRejections returns how many times the price of each source was
+// rejected as older than its max age since the timer started.
+func (t *Timer) StaleRejections() map[string]uint64 {
+	return t.counts(t.stale)
+}
 
-	// Use gjson to parse and extract the value from the JSON dynamically
-	result := gjson.GetBytes(body, t.apiDetails.JSONPath)
-	if !result.Exists() {
-		return 0.0, fmt.Errorf("failed to extract price using JSONPath: %s", t.apiDetails.JSONPath)
+func (t *Timer) fetchSource(ctx context.Context, source timedSource) SourceResult {
+	start := time.Now()
+	quote, err := source.fetchQuote(ctx)
+	return SourceResult{
+		Source:  source.Name(),
+		Price:   quote.Price,
+		Samples: quote.Samples,
+		Latency: time.Since(start),
+		Err:     err,
 	}
+}
 
-	return result.Float(), nil
+// Fetch requests the API and extracts the price at the JSON path.
+func (d *APIRequestDetails) Fetch(ctx context.Context) (decimal.Decimal, error) {
+	quote, err := d.FetchQuote(ctx)
+	return quote.Price, err
 }
 
-// func (t *Timer) MakeHttpRequest() (float64, error) {
-// 	t.logger.WithFields(logrus.Fields{
-// 		"URL": t.url,
-// 	}).Info("Making Http Get Request")
-// 	response, err := http.Get(t.url)
-// 	if err != nil {
-// 		return 0.0, fmt.Errorf("error making request: %v", err)
-// 	}
-// 	body, err := io.ReadAll(response.Body)
-// 	if err != nil {
-// 		return 0.0, fmt.Errorf("error reading response: %v", err)
-// 	}
+// FetchQuote requests the API and extracts the price and, when their JSON
+// paths are configured, the volume and the update time.
+func (d *APIRequestDetails) FetchQuote(ctx context.Context) (Quote, error) {
+	data, err := d.fetcher.Fetch(ctx, d.newRequest)
+	if err != nil {
+		return Quote{}, err
+	}
+	quote := Quote{UpdatedAt: time.Now()}
+	if quote.Price, err = pipeline.ExtractPrice(data, d.JSONPath); err != nil {
+		return Quote{}, err
+	}
+	if d.TimestampJSONPath != "" {
+		if quote.UpdatedAt, err = ExtractTimestamp(data, d.TimestampJSONPath); err != nil {
+			return Quote{}, err
+		}
+	}
+	if d.VolumeJSONPath != "" {
+		if quote.Volume, err = pipeline.ExtractPrice(data, d.VolumeJSONPath); err != nil {
+			return Quote{}, fmt.Errorf("volume: %w", err)
+		}
+	}
+	return quote, nil
+}
 
-// 	var resp PriceResponse
-// 	err = json.Unmarshal(body, &resp)
-// 	if err != nil {
-// 		logrus.Errorf("failed to unmarshall %v, Err: %v", response, err)
-// 	}
+func (d *APIRequestDetails) newRequest(ctx context.Context) (*http.Request, error) {
+	var body io.Reader
+	if d.Body != "" {
+		body = strings.NewReader(d.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, d.Method, d.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	if d.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-// 	response.Body.Close()
-// 	return resp.Ripple.Usd, nil
-// }
+	// Add headers to the request
+	for key, value := range d.Headers {
+		req.Header.Add(key, value)
+	}
+	authenticate(req, d.Auth, d.Body, time.Now())
+	return req, nil
+}
@@ -0,0 +1,805 @@
+package timer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"erinaceus_data_feeds/config"
+	"erinaceus_data_feeds/services/fetcher"
+	"erinaceus_data_feeds/utils/scale"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTimer(t *testing.T, url, jsonPath string) *Timer {
+	t.Helper()
+	feed := config.DefaultFeed()
+	feed.Source = config.Source{URL: url, JSONPath: jsonPath}
+	return newTestTimerForFeed(t, feed)
+}
+
+func newTestTimerForFeed(t *testing.T, feed config.Feed) *Timer {
+	t.Helper()
+	feed.SetDefaults()
+	timer, err := NewTimerService(feed, SourceDeps{}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	return timer
+}
+
+func TestFetchDataKeepsPrecision(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"ripple":{"usd":0.000001234567891}}`, "0.000001234567891"},
+		{`{"ripple":{"usd":123456789.123456789}}`, "123456789.123456789"},
+		{`{"ripple":{"usd":"123456789.123456789"}}`, "123456789.123456789"},
+		{`{"ripple":{"usd":1.5e-7}}`, "0.00000015"},
+		{`{"ripple":{"usd":-42.10}}`, "-42.1"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.body, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tc.body)
+			}))
+			defer srv.Close()
+
+			price, err := newTestTimer(t, srv.URL, "ripple.usd").FetchData()
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, price.String())
+		})
+	}
+}
+
+func TestFetchDataEndToEndAnswer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ripple":{"usd":123456789.123456789}}`)
+	}))
+	defer srv.Close()
+
+	price, err := newTestTimer(t, srv.URL, "ripple.usd").FetchData()
+	require.NoError(t, err)
+	answer, err := scale.ToSubmission(price, 18, scale.RoundHalfUp)
+	require.NoError(t, err)
+	assert.Equal(t, "123456789123456789000000000", answer.String())
+}
+
+func TestFetchDataRejectsNonNumbers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ripple":{"usd":"n/a"},"xrp":{"usd":true}}`)
+	}))
+	defer srv.Close()
+
+	_, err := newTestTimer(t, srv.URL, "ripple.usd").FetchData()
+	require.Error(t, err)
+	_, err = newTestTimer(t, srv.URL, "xrp.usd").FetchData()
+	require.Error(t, err)
+	_, err = newTestTimer(t, srv.URL, "missing").FetchData()
+	require.Error(t, err)
+}
+
+func priceServer(t *testing.T, body string, delay time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestObserveMedianWithQuorum(t *testing.T) {
+	feed := config.DefaultFeed()
+	feed.Quorum = 2
+	feed.Sources = []config.Source{
+		{Name: "a", URL: priceServer(t, `{"p":1.10}`, 0).URL, JSONPath: "p"},
+		{Name: "b", URL: priceServer(t, `{"p":1.30}`, 0).URL, JSONPath: "p"},
+		{Name: "c", URL: priceServer(t, `{"p":1.20}`, time.Second).URL, JSONPath: "p", Timeout: config.Duration(50 * time.Millisecond)},
+	}
+
+	observation, err := newTestTimerForFeed(t, feed).Observe(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1.2", observation.Price.String())
+	require.Len(t, observation.Results, 3)
+	assert.Error(t, observation.Results[2].Err)
+}
+
+func TestObserveBelowQuorum(t *testing.T) {
+	feed := config.DefaultFeed()
+	feed.Sources = []config.Source{
+		{Name: "a", URL: priceServer(t, `{"p":1.10}`, 0).URL, JSONPath: "p"},
+		{Name: "b", URL: priceServer(t, `{}`, 0).URL, JSONPath: "p"},
+		{Name: "c", URL: priceServer(t, `{}`, 0).URL, JSONPath: "p"},
+	}
+
+	_, err := newTestTimerForFeed(t, feed).Observe(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only 1 of 3 sources answered, quorum is 2")
+}
+
+func TestMedian(t *testing.T) {
+	prices := func(values ...string) []decimal.Decimal {
+		var out []decimal.Decimal
+		for _, v := range values {
+			out = append(out, decimal.RequireFromString(v))
+		}
+		return out
+	}
+	assert.Equal(t, "0", Median(nil).String())
+	assert.Equal(t, "3", Median(prices("3")).String())
+	assert.Equal(t, "2", Median(prices("3", "1", "2")).String())
+	assert.Equal(t, "2.5", Median(prices("4", "1", "3", "2")).String())
+	assert.Equal(t, "0.0000012345678915", Median(prices("0.000001234567891", "0.000001234567892")).String())
+	assert.Equal(t, "0.0000000000000000015", Median(prices("0.000000000000000001", "0.000000000000000002")).String())
+	assert.Equal(t, "1.0000000000000000015", Median(prices("1.000000000000000002", "1.000000000000000001")).String())
+}
+
+func testResults(prices ...string) []SourceResult {
+	var results []SourceResult
+	for i, price := range prices {
+		results = append(results, SourceResult{Source: fmt.Sprintf("s%d", i), Price: decimal.RequireFromString(price)})
+	}
+	return results
+}
+
+func acceptedSources(results []SourceResult) []string {
+	var sources []string
+	for _, result := range results {
+		sources = append(sources, result.Source)
+	}
+	return sources
+}
+
+func TestOutlierFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.OutlierFilter
+		prices   []string
+		accepted []string
+		price    string
+	}{
+		{"none", config.OutlierFilter{Method: config.OutlierNone}, []string{"1", "2", "100"}, []string{"s0", "s1", "s2"}, "2"},
+		{"max deviation", config.OutlierFilter{Method: config.OutlierMaxDeviation, MaxDeviation: 5}, []string{"1.00", "1.02", "0.99", "1.20"}, []string{"s0", "s1", "s2"}, "1"},
+		{"mad", config.OutlierFilter{Method: config.OutlierMAD, MADMultiplier: 3}, []string{"10.0", "10.1", "9.9", "10.2", "14"}, []string{"s0", "s1", "s2", "s3"}, "10.05"},
+		{"mad identical", config.OutlierFilter{Method: config.OutlierMAD, MADMultiplier: 3}, []string{"5", "5", "5", "6"}, []string{"s0", "s1", "s2"}, "5"},
+		{"trimmed mean", config.OutlierFilter{Method: config.OutlierTrimmedMean, TrimFraction: 0.2}, []string{"3", "1", "100", "2", "4"}, []string{"s3", "s0", "s4"}, "3"},
+		{"max deviation high precision", config.OutlierFilter{Method: config.OutlierMaxDeviation, MaxDeviation: 1e-17}, []string{"1", "1", "1.000000000000000001"}, []string{"s0", "s1"}, "1"},
+		{"trimmed mean high precision", config.OutlierFilter{Method: config.OutlierTrimmedMean}, []string{"1.000000000000000001", "1.000000000000000002"}, []string{"s0", "s1"}, "1.0000000000000000015"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filter := NewOutlierFilter(tc.cfg)
+			accepted, rejected := filter.Filter(testResults(tc.prices...))
+			assert.Equal(t, tc.accepted, acceptedSources(accepted))
+			assert.Len(t, rejected, len(tc.prices)-len(tc.accepted))
+			for _, rejection := range rejected {
+				assert.NotEmpty(t, rejection.Reason)
+			}
+			assert.Equal(t, tc.price, filter.Aggregate(resultPrices(accepted)).String())
+		})
+	}
+}
+
+func TestObserveRejectsOutliers(t *testing.T) {
+	feed := config.DefaultFeed()
+	feed.Outliers = config.OutlierFilter{Method: config.OutlierMaxDeviation, MaxDeviation: 1}
+	feed.Sources = []config.Source{
+		{Name: "a", URL: priceServer(t, `{"p":1.00}`, 0).URL, JSONPath: "p"},
+		{Name: "b", URL: priceServer(t, `{"p":1.01}`, 0).URL, JSONPath: "p"},
+		{Name: "c", URL: priceServer(t, `{"p":1.50}`, 0).URL, JSONPath: "p"},
+	}
+	timer := newTestTimerForFeed(t, feed)
+
+	for i := 0; i < 2; i++ {
+		observation, err := timer.Observe(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "1.005", observation.Price.String())
+		require.Len(t, observation.Rejected, 1)
+		assert.Equal(t, "c", observation.Rejected[0].Source)
+	}
+	assert.Equal(t, map[string]uint64{"c": 2}, timer.OutlierRejections())
+
+	feed.Quorum = 3
+	_, err := newTestTimerForFeed(t, feed).Observe(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only 2 of 3 sources passed the outlier filter, quorum is 3")
+}
+
+func TestPriceSources(t *testing.T) {
+	post := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || string(body) != `{"pair":"XRP/USD"}` {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"result":{"price":"0.51"}}`)
+	}))
+	defer post.Close()
+
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "price.txt")
+	require.NoError(t, os.WriteFile(plain, []byte("0.52\n"), 0600))
+	structured := filepath.Join(dir, "price.json")
+	require.NoError(t, os.WriteFile(structured, []byte(`{"xrp":0.53}`), 0600))
+
+	feed := config.DefaultFeed()
+	feed.Sources = []config.Source{
+		{Type: config.SourceHTTPPost, URL: post.URL, Body: `{"pair":"XRP/USD"}`, JSONPath: "result.price"},
+		{Type: config.SourceStatic, Value: "0.50"},
+		{Type: config.SourceFile, Path: plain},
+		{Type: config.SourceFile, Path: structured, JSONPath: "xrp"},
+	}
+	observation, err := newTestTimerForFeed(t, feed).Observe(context.Background())
+	require.NoError(t, err)
+	var prices []string
+	for _, result := range observation.Results {
+		require.NoError(t, result.Err, result.Source)
+		prices = append(prices, result.Price.String())
+	}
+	assert.Equal(t, []string{"0.51", "0.5", "0.52", "0.53"}, prices)
+	assert.Equal(t, "static", observation.Results[1].Source)
+	assert.Equal(t, plain, observation.Results[2].Source)
+}
+
+type fixedSource struct {
+	name  string
+	price decimal.Decimal
+}
+
+func (s fixedSource) Name() string { return s.name }
+
+func (s fixedSource) Fetch(context.Context) (decimal.Decimal, error) { return s.price, nil }
+
+func TestRegisterSource(t *testing.T) {
+	RegisterSource("test_fixed", func(source config.Source, _ SourceDeps) (PriceSource, error) {
+		return fixedSource{name: source.Name, price: decimal.RequireFromString(source.Params["price"])}, nil
+	})
+	assert.Panics(t, func() {
+		RegisterSource("test_fixed", nil)
+	})
+
+	feed := config.DefaultFeed()
+	feed.Source = config.Source{Type: "test_fixed", Params: map[string]string{"price": "7.5"}}
+	price, err := newTestTimerForFeed(t, feed).FetchData()
+	require.NoError(t, err)
+	assert.Equal(t, "7.5", price.String())
+
+	feed.Source = config.Source{Type: "unregistered"}
+	feed.SetDefaults()
+	_, err = NewTimerService(feed, SourceDeps{}, logrus.NewEntry(logrus.New()))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown price source type "unregistered"`)
+}
+
+func TestSourceAuth(t *testing.T) {
+	tests := []struct {
+		name  string
+		auth  config.Auth
+		check func(r *http.Request) bool
+	}{
+		{"header", config.Auth{Type: config.AuthHeader, Name: "X-CMC_PRO_API_KEY", Key: "k"}, func(r *http.Request) bool {
+			return r.Header.Get("X-CMC_PRO_API_KEY") == "k"
+		}},
+		{"query", config.Auth{Type: config.AuthQuery, Name: "api_key", Key: "k&1"}, func(r *http.Request) bool {
+			return r.URL.Query().Get("api_key") == "k&1" && r.URL.Query().Get("ids") == "ripple"
+		}},
+		{"bearer", config.Auth{Type: config.AuthBearer, Key: "tok"}, func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer tok"
+		}},
+		{"basic", config.Auth{Type: config.AuthBasic, Username: "user", Password: "pass"}, func(r *http.Request) bool {
+			user, pass, ok := r.BasicAuth()
+			return ok && user == "user" && pass == "pass"
+		}},
+		{"hmac", config.Auth{Type: config.AuthHMAC, Key: "k", Secret: "s"}, func(r *http.Request) bool {
+			timestamp := r.Header.Get("X-Timestamp")
+			return r.Header.Get("X-API-Key") == "k" && timestamp != "" &&
+				r.Header.Get("X-Signature") == Sign("s", timestamp, r.Method, r.URL.RequestURI(), "")
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !tc.check(r) {
+					http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(w, `{"p":1}`)
+			}))
+			defer srv.Close()
+
+			feed := config.DefaultFeed()
+			feed.Source = config.Source{URL: srv.URL + "/price?ids=ripple", JSONPath: "p", Auth: tc.auth}
+			price, err := newTestTimerForFeed(t, feed).FetchData()
+			require.NoError(t, err)
+			assert.Equal(t, "1", price.String())
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t,
+		"9f8c5e2c3f7d5a2b769da36bdaf2767a2bea9b03adf8091117c2ead1340eff38",
+		Sign("secret", "1700000000000", "GET", "/price?ids=ripple", ""),
+	)
+}
+
+func TestFetchDataErrorKinds(t *testing.T) {
+	html := priceServer(t, "<html>maintenance</html>", 0)
+	_, err := newTestTimer(t, html.URL, "p").sources[0].Fetch(context.Background())
+	require.Error(t, err)
+	assert.ErrorIs(t, err, fetcher.ErrParse)
+
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+	feed := config.DefaultFeed()
+	feed.Source = config.Source{URL: limited.URL, JSONPath: "p", Timeout: config.Duration(10 * time.Second)}
+	_, err = newTestTimerForFeed(t, feed).sources[0].Fetch(context.Background())
+	require.Error(t, err)
+	assert.ErrorIs(t, err, fetcher.ErrRateLimited)
+}
+
+func TestObserveWithObservationSource(t *testing.T) {
+	feed := config.DefaultFeed()
+	feed.Sources = []config.Source{{Name: "xrp", Type: config.SourceStatic, Value: "0.5"}}
+	feed.ObservationSource = fmt.Sprintf(`
+		usd_eur [type=http url="%s"]
+		usd_eur_parse [type=jsonparse path="rates.EUR"]
+		xrp_usd [type=source name="xrp"]
+		xrp_eur [type=multiply]
+		usd_eur -> usd_eur_parse -> xrp_eur
+		xrp_usd -> xrp_eur
+	`, priceServer(t, `{"rates":{"EUR":0.92}}`, 0).URL)
+
+	observation, err := newTestTimerForFeed(t, feed).Observe(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "0.46", observation.Price.String())
+	assert.Len(t, observation.Trace, 4)
+
+	feed.ObservationSource = `eur [type=source name="eur"]`
+	feed.SetDefaults()
+	_, err = NewTimerService(feed, SourceDeps{}, logrus.NewEntry(logrus.New()))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid observation source: source task reads unknown source "eur"`)
+}
+
+type quoteSource struct {
+	fixedSource
+	updatedAt time.Time
+}
+
+func (s quoteSource) FetchQuote(context.Context) (Quote, error) {
+	return Quote{Price: s.price, UpdatedAt: s.updatedAt}, nil
+}
+
+var registerQuoteSource sync.Once
+
+// newQuoteSourceType registers the test_quote type, a fixed price last
+// updated the age param ago.
+func newQuoteSourceType() string {
+	registerQuoteSource.Do(func() {
+		RegisterSource("test_quote", func(source config.Source, _ SourceDeps) (PriceSource, error) {
+			age, err := time.ParseDuration(source.Params["age"])
+			if err != nil {
+				return nil, err
+			}
+			return quoteSource{
+				fixedSource: fixedSource{name: source.Name, price: decimal.RequireFromString(source.Value)},
+				updatedAt:   time.Now().Add(-age),
+			}, nil
+		})
+	})
+	return "test_quote"
+}
+
+func TestDerivedSource(t *testing.T) {
+	quoteType := newQuoteSourceType()
+	xrpUSD := config.Source{Name: "xrp_usd", URL: priceServer(t, `{"ripple":{"usd":"0.52"}}`, 0).URL, JSONPath: "ripple.usd"}
+	ftnUSD := config.Source{Name: "ftn_usd", Type: quoteType, Value: "3", Params: map[string]string{"age": "10m"}}
+	derived := config.Source{
+		Name:        "xrp_ftn",
+		Type:        config.SourceDerived,
+		Numerator:   []config.Source{xrpUSD},
+		Denominator: []config.Source{ftnUSD},
+	}
+
+	feed := config.DefaultFeed()
+	feed.Source = derived
+	timer := newTestTimerForFeed(t, feed)
+	quote, err := FetchQuote(context.Background(), timer.sources[0].PriceSource)
+	require.NoError(t, err)
+	assert.Equal(t, "0.173333333333333333333333", quote.Price.String())
+	assert.WithinDuration(t, time.Now().Add(-10*time.Minute), quote.UpdatedAt, time.Second)
+
+	feed.Source.MaxAge = config.Duration(5 * time.Minute)
+	_, err = newTestTimerForFeed(t, feed).FetchData()
+	require.Error(t, err)
+
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+	feed.Source = derived
+	feed.Source.Numerator = []config.Source{{Name: "limited", URL: limited.URL, JSONPath: "p", Timeout: config.Duration(10 * time.Second)}}
+	_, err = newTestTimerForFeed(t, feed).sources[0].Fetch(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "input limited: ")
+	assert.ErrorIs(t, err, fetcher.ErrRateLimited)
+}
+
+func TestDerivedSourceStale(t *testing.T) {
+	quoteType := newQuoteSourceType()
+	feed := config.DefaultFeed()
+	feed.Source = config.Source{
+		Name:        "xrp_ftn",
+		Type:        config.SourceDerived,
+		MaxAge:      config.Duration(time.Minute),
+		Numerator:   []config.Source{{Name: "xrp_usd", Type: quoteType, Value: "1", Params: map[string]string{"age": "0s"}}},
+		Denominator: []config.Source{{Name: "ftn_usd", Type: quoteType, Value: "2", Params: map[string]string{"age": "1h"}}},
+	}
+	_, err := newTestTimerForFeed(t, feed).sources[0].Fetch(context.Background())
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrStale)
+	assert.Contains(t, err.Error(), "input ftn_usd: price is stale: updated 1h0m0s ago, max age is 1m0s")
+}
+
+func TestTWAPAndVWAP(t *testing.T) {
+	now := time.Now()
+	samples := []sample{
+		{at: now.Add(-40 * time.Second), price: decimal.RequireFromString("10"), volume: decimal.RequireFromString("1")},
+		{at: now.Add(-10 * time.Second), price: decimal.RequireFromString("20"), volume: decimal.RequireFromString("3")},
+	}
+	// 10 held for 30s, 20 for the last 10s.
+	assert.Equal(t, "12.5", twap(samples, now).String())
+	price, err := vwap(samples)
+	require.NoError(t, err)
+	assert.Equal(t, "17.5", price.String())
+
+	samples[0].volume, samples[1].volume = decimal.Zero, decimal.Zero
+	_, err = vwap(samples)
+	assert.Error(t, err)
+}
+
+// flakySource answers its prices in turn, failing on the empty ones.
+type flakySource struct {
+	prices []string
+	calls  int
+}
+
+func (s *flakySource) Name() string { return "flaky" }
+
+func (s *flakySource) Fetch(context.Context) (decimal.Decimal, error) {
+	price := s.prices[s.calls%len(s.prices)]
+	s.calls++
+	if price == "" {
+		return decimal.Zero, errors.New("source down")
+	}
+	return decimal.RequireFromString(price), nil
+}
+
+func TestSampledSourceSurvivesOutages(t *testing.T) {
+	source := &flakySource{prices: []string{"10", "", "", "20"}}
+	sampler := newSampledSource(timedSource{PriceSource: source, timeout: time.Second}, config.Sampling{
+		Mode:       config.SamplingTWAP,
+		Interval:   config.Duration(time.Millisecond),
+		Window:     config.Duration(time.Minute),
+		MinSamples: 2,
+	})
+	ctx := context.Background()
+
+	require.NoError(t, sampler.Sample(ctx))
+	require.Error(t, sampler.Sample(ctx))
+	_, err := sampler.FetchQuote(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only 1 samples")
+	assert.Contains(t, err.Error(), "source down")
+
+	require.Error(t, sampler.Sample(ctx))
+	require.NoError(t, sampler.Sample(ctx))
+	quote, err := sampler.FetchQuote(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, quote.Samples)
+	assert.True(t, quote.Price.GreaterThan(decimal.RequireFromString("10")))
+	assert.True(t, quote.Price.LessThan(decimal.RequireFromString("20")))
+
+	sampler.window = 0
+	_, err = sampler.FetchQuote(ctx)
+	assert.Error(t, err, "samples older than the window are dropped")
+}
+
+func TestObserveWithSampling(t *testing.T) {
+	server := priceServer(t, `{"price": "2.5"}`, 0)
+	feed := config.DefaultFeed()
+	feed.Source = config.Source{URL: server.URL, JSONPath: "price"}
+	feed.Sampling = config.Sampling{Mode: config.SamplingTWAP, MinSamples: 1}
+	timer := newTestTimerForFeed(t, feed)
+	require.Len(t, timer.samplers, 1)
+
+	_, err := timer.Observe(context.Background())
+	require.Error(t, err, "nothing is sampled before the timer starts")
+
+	require.NoError(t, timer.samplers[0].Sample(context.Background()))
+	observation, err := timer.Observe(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "2.5", observation.Price.String())
+	assert.Equal(t, 1, observation.Results[0].Samples)
+}
+
+func TestExtractTimestamp(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, data := range []string{
+		`{"t": 1714564800}`,
+		`{"t": "1714564800"}`,
+		`{"t": 1714564800000}`,
+		`{"t": "2024-05-01T12:00:00Z"}`,
+	} {
+		updatedAt, err := ExtractTimestamp([]byte(data), "t")
+		require.NoError(t, err, data)
+		assert.True(t, want.Equal(updatedAt), data)
+	}
+
+	_, err := ExtractTimestamp([]byte(`{"t": "yesterday"}`), "t")
+	assert.ErrorIs(t, err, fetcher.ErrParse)
+	_, err = ExtractTimestamp([]byte(`{}`), "t")
+	assert.ErrorIs(t, err, fetcher.ErrParse)
+}
+
+func TestObserveRejectsStalePrices(t *testing.T) {
+	now := time.Now().Unix()
+	fresh := priceServer(t, fmt.Sprintf(`{"price": "1.0", "updated": %d}`, now), 0)
+	stale := priceServer(t, fmt.Sprintf(`{"price": "9.0", "updated": %d}`, now-3600), 0)
+	feed := config.DefaultFeed()
+	feed.Quorum = 1
+	feed.Sources = []config.Source{
+		{Name: "fresh", URL: fresh.URL, JSONPath: "price", TimestampJSONPath: "updated", MaxAge: config.Duration(time.Minute)},
+		{Name: "stale", URL: stale.URL, JSONPath: "price", TimestampJSONPath: "updated", MaxAge: config.Duration(time.Minute)},
+	}
+	timer := newTestTimerForFeed(t, feed)
+
+	observation, err := timer.Observe(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1", observation.Price.String())
+	assert.ErrorIs(t, observation.Results[1].Err, ErrStale)
+	assert.Equal(t, map[string]uint64{"stale": 1}, timer.StaleRejections())
+
+	feed.Quorum = 2
+	_, err = newTestTimerForFeed(t, feed).Observe(context.Background())
+	assert.Error(t, err, "a stale price does not count towards the quorum")
+}
+
+func TestObservationSourceRejectsStalePrices(t *testing.T) {
+	stale := priceServer(t, fmt.Sprintf(`{"price": "9.0", "updated": %d}`, time.Now().Unix()-3600), 0)
+	feed := config.DefaultFeed()
+	feed.Sources = []config.Source{
+		{Name: "stale", URL: stale.URL, JSONPath: "price", TimestampJSONPath: "updated", MaxAge: config.Duration(time.Minute)},
+	}
+	feed.ObservationSource = `
+		stale  [type=source name="stale"]
+		scaled [type=multiply times="2"]
+		stale -> scaled
+	`
+	timer := newTestTimerForFeed(t, feed)
+
+	_, err := timer.Observe(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, map[string]uint64{"stale": 1}, timer.StaleRejections())
+}
+
+func TestFileSourceAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "price")
+	require.NoError(t, os.WriteFile(path, []byte("1.5"), 0o600))
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	feed := config.DefaultFeed()
+	feed.Source = config.Source{Type: config.SourceFile, Path: path, MaxAge: config.Duration(time.Minute)}
+	source := newTestTimerForFeed(t, feed).sources[0]
+	_, err := source.Fetch(context.Background())
+	assert.ErrorIs(t, err, ErrStale)
+
+	require.NoError(t, os.WriteFile(path, []byte("1.5"), 0o600))
+	price, err := source.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", price.String())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := config.CircuitBreaker{FailureThreshold: 2, Cooldown: config.Duration(time.Minute)}
+	health := newSourceHealth("api", breaker, logrus.NewEntry(logrus.New()))
+	now := time.Now()
+	failure := errors.New("boom")
+
+	require.NoError(t, health.allow(now))
+	health.record(now, time.Second, failure)
+	assert.Equal(t, CircuitClosed, health.snapshot().State)
+	health.record(now, time.Second, failure)
+	assert.Equal(t, CircuitOpen, health.snapshot().State)
+	assert.ErrorIs(t, health.allow(now.Add(30*time.Second)), ErrCircuitOpen)
+
+	// After the cooldown a single probe goes through and fails.
+	require.NoError(t, health.allow(now.Add(time.Minute)))
+	assert.ErrorIs(t, health.allow(now.Add(time.Minute)), ErrCircuitOpen)
+	health.record(now.Add(time.Minute), time.Second, failure)
+	assert.Equal(t, CircuitOpen, health.snapshot().State)
+	assert.ErrorIs(t, health.allow(now.Add(90*time.Second)), ErrCircuitOpen)
+
+	// The next probe succeeds and closes the breaker.
+	require.NoError(t, health.allow(now.Add(2*time.Minute)))
+	health.record(now.Add(2*time.Minute), time.Second, nil)
+	snapshot := health.snapshot()
+	assert.Equal(t, CircuitClosed, snapshot.State)
+	assert.Equal(t, uint64(4), snapshot.Fetches)
+	assert.Equal(t, uint64(3), snapshot.Failures)
+	assert.Equal(t, 0, snapshot.ConsecutiveFailures)
+	assert.Equal(t, "boom", snapshot.LastError)
+	assert.Less(t, snapshot.SuccessRate, 1.0)
+	require.NoError(t, health.allow(now.Add(2*time.Minute)))
+}
+
+func TestObserveSkipsOpenCircuits(t *testing.T) {
+	var requests int
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(failing.Close)
+	healthy := priceServer(t, `{"price": "1.0"}`, 0)
+	feed := config.DefaultFeed()
+	feed.Quorum = 1
+	feed.CircuitBreaker = config.CircuitBreaker{FailureThreshold: 2, Cooldown: config.Duration(time.Hour)}
+	feed.Sources = []config.Source{
+		{Name: "failing", URL: failing.URL, JSONPath: "price"},
+		{Name: "healthy", URL: healthy.URL, JSONPath: "price"},
+	}
+	timer := newTestTimerForFeed(t, feed)
+
+	for i := 0; i < 3; i++ {
+		_, err := timer.Observe(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, requests)
+	health := timer.Health()
+	require.Len(t, health, 2)
+	assert.Equal(t, CircuitOpen, health[0].State)
+	assert.Equal(t, uint64(2), health[0].Failures)
+	assert.Contains(t, health[0].LastError, "400")
+	assert.Equal(t, CircuitClosed, health[1].State)
+	assert.Equal(t, uint64(3), health[1].Fetches)
+}
+
+// fakeRoundClock answers a fixed on-chain update time.
+type fakeRoundClock struct {
+	timestamp int64
+	err       error
+}
+
+func (c *fakeRoundClock) LatestTimestamp(*bind.CallOpts) (*big.Int, error) {
+	return big.NewInt(c.timestamp), c.err
+}
+
+func TestHeartbeat(t *testing.T) {
+	clock := &fakeRoundClock{timestamp: time.Now().Add(-30 * time.Second).Unix()}
+	h := newHeartbeat(config.IdleTimer{Period: config.Duration(time.Minute)}, clock)
+	ctx := context.Background()
+
+	due, err := h.due(ctx)
+	require.NoError(t, err)
+	assert.False(t, due, "the answer is younger than the period")
+
+	clock.timestamp = time.Now().Add(-2 * time.Minute).Unix()
+	due, err = h.due(ctx)
+	require.NoError(t, err)
+	assert.False(t, due, "a newer answer seen earlier is kept")
+
+	h = newHeartbeat(config.IdleTimer{Period: config.Duration(time.Minute)}, clock)
+	due, err = h.due(ctx)
+	require.NoError(t, err)
+	assert.True(t, due)
+
+	// An AnswerUpdated event from another oracle re-arms the heartbeat.
+	h.arm(time.Now())
+	due, err = h.due(ctx)
+	require.NoError(t, err)
+	assert.False(t, due)
+
+	clock.timestamp = 0
+	h = newHeartbeat(config.IdleTimer{Period: config.Duration(time.Minute)}, clock)
+	due, err = h.due(ctx)
+	require.NoError(t, err)
+	assert.False(t, due, "a round waiting for its first answer is not stale")
+
+	clock.err = errors.New("node down")
+	_, err = h.due(ctx)
+	assert.Error(t, err)
+}
+
+func TestHeartbeatFiresWhenAnswerGetsOld(t *testing.T) {
+	period := 50 * time.Millisecond
+	clock := &fakeRoundClock{timestamp: time.Now().Unix()}
+	h := newHeartbeat(config.IdleTimer{Period: config.Duration(period)}, clock)
+	<-h.timer.C
+	h.arm(time.Now().Add(-period + 10*time.Millisecond))
+	select {
+	case <-h.timer.C:
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat did not fire")
+	}
+}
+
+func TestRoundAgeIdleTimerNeedsClient(t *testing.T) {
+	feed := config.DefaultFeed()
+	feed.Source = config.Source{Type: config.SourceStatic, Value: "1"}
+	feed.IdleTimer.Mode = config.IdleTimerRoundAge
+	feed.SetDefaults()
+	_, err := NewTimerService(feed, SourceDeps{}, logrus.NewEntry(logrus.New()))
+	assert.ErrorContains(t, err, "round_age idle timer needs a node client")
+}
+
+func TestCronDrumbeatAndMarketHours(t *testing.T) {
+	feed := config.DefaultFeed()
+	feed.Source = config.Source{Type: config.SourceStatic, Value: "1"}
+	feed.Drumbeat = config.Drumbeat{Enabled: true, Schedule: "0 * * * *"}
+	feed.MarketHours = config.MarketHours{Enabled: true, Timezone: "America/New_York", Open: "09:30", Close: "16:00", Holidays: []string{"2026-12-25"}}
+	feed.SetDefaults()
+	timer, err := NewTimerService(feed, SourceDeps{}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	require.NotNil(t, timer.drumbeatTick)
+
+	assert.True(t, timer.MarketOpen(time.Date(2026, 12, 24, 15, 0, 0, 0, time.UTC)))
+	assert.False(t, timer.MarketOpen(time.Date(2026, 12, 25, 15, 0, 0, 0, time.UTC)))
+	assert.False(t, timer.MarketOpen(time.Date(2026, 12, 24, 22, 0, 0, 0, time.UTC)))
+
+	assert.False(t, timer.DeviationAllowed(time.Date(2026, 12, 24, 22, 0, 0, 0, time.UTC)))
+
+	feed.MarketHours.DeviationOutsideHours = true
+	timer, err = NewTimerService(feed, SourceDeps{}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	assert.True(t, timer.DeviationAllowed(time.Date(2026, 12, 24, 22, 0, 0, 0, time.UTC)))
+
+	feed.MarketHours.Enabled = false
+	timer, err = NewTimerService(feed, SourceDeps{}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	assert.True(t, timer.MarketOpen(time.Date(2026, 12, 25, 15, 0, 0, 0, time.UTC)))
+}
+
+func TestDrumbeatDelayKeepsPolling(t *testing.T) {
+	feed := config.DefaultFeed()
+	feed.Source = config.Source{Type: config.SourceStatic, Value: "1"}
+	feed.PollTimer = config.Timer{Period: config.Duration(10 * time.Millisecond)}
+	feed.IdleTimer.Disabled = true
+	feed.Drumbeat = config.Drumbeat{Enabled: true, Schedule: "@every 20ms", RandomDelay: config.Duration(time.Hour)}
+	feed.SetDefaults()
+	timer, err := NewTimerService(feed, SourceDeps{}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	go timer.Start()
+
+	deadline := time.After(5 * time.Second)
+	for polls := 0; polls < 10; polls++ {
+		select {
+		case <-timer.PriceChan:
+		case <-timer.DrumbeatChan:
+			t.Fatal("drumbeat fired before its delay")
+		case <-deadline:
+			t.Fatalf("polled %d times while the drumbeat was delayed", polls)
+		}
+	}
+}
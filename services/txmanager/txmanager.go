@@ -0,0 +1,360 @@
+package txmanager
+
+import (
+	"context"
+	"erinaceus_data_feeds/config"
+	wallet_service "erinaceus_data_feeds/services/wallet"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrSuperseded is passed to the OnDone of a transaction given up on because
+// it became useless before being mined.
+var ErrSuperseded = errors.New("transaction superseded")
+
+// gasLimitPercent is the gas limit of a transaction, in percent of its
+// estimate, as the state it runs against may change before it is mined.
+const gasLimitPercent = 120
+
+// broadcastTimeout bounds the broadcast of a transaction to the node.
+const broadcastTimeout = 30 * time.Second
+
+// Backend is the part of the node client the manager sends transactions
+// through, implemented by client.Client.
+type Backend interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// Request is a transaction to send.
+type Request struct {
+	To   common.Address
+	Data []byte
+	// Superseded reports whether the transaction became useless, as when its
+	// round is over. The manager then stops replacing it. Optional.
+	Superseded func(ctx context.Context) (bool, error)
+	// OnDone is called once with the receipt of the mined transaction, or
+	// the error it was given up with. Optional.
+	OnDone func(receipt *types.Receipt, err error)
+}
+
+// pendingTx is a transaction waiting to be mined, with the hashes of every
+// gas price it was broadcast with.
+type pendingTx struct {
+	req      Request
+	nonce    uint64
+	gasLimit uint64
+	gasPrice *big.Int
+	hashes   []common.Hash
+	// sentAt is the block of the latest broadcast.
+	sentAt uint64
+	// nonceUsed is set when a node rejected the nonce as already used.
+	nonceUsed bool
+	// tx is the latest signed transaction, broadcast again while unsent.
+	tx     *types.Transaction
+	unsent bool
+}
+
+// TxManager sends the transactions of the transmitter key. It owns the nonce
+// of the key, reading it from the node only at start and after a rejected
+// nonce, broadcasts without waiting for the transactions to be mined, and
+// rebroadcasts them with a bumped gas price while they stay unmined.
+type TxManager struct {
+	backend       Backend
+	chainID       *big.Int
+	walletService *wallet_service.WalletService
+	cfg           config.TxManager
+	logger        *logrus.Logger
+
+	mu          sync.Mutex
+	nonce       uint64
+	nonceLoaded bool
+	pending     []*pendingTx
+	// abandoned are the superseded transactions still unmined, whose nonces
+	// are reused by the next transactions.
+	abandoned []*pendingTx
+}
+
+func NewTxManager(backend Backend, chainID int64, cfg config.TxManager, walletService *wallet_service.WalletService, logger *logrus.Logger) *TxManager {
+	return &TxManager{
+		backend:       backend,
+		chainID:       big.NewInt(chainID),
+		walletService: walletService,
+		cfg:           cfg,
+		logger:        logger,
+	}
+}
+
+// Send signs the transaction of req with the next nonce and broadcasts it in
+// the background. It returns once the transaction is signed.
+func (m *TxManager) Send(ctx context.Context, req Request) (common.Hash, error) {
+	key := m.walletService.Key
+	gasLimit, err := m.backend.EstimateGas(ctx, ethereum.CallMsg{From: key.Address, To: &req.To, Data: req.Data})
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to estimate gas %v", err)
+	}
+	gasPrice, err := m.backend.SuggestGasPrice(ctx)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to get gas price %v", err)
+	}
+	block, err := m.backend.BlockNumber(ctx)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to get block number %v", err)
+	}
+
+	replaced := m.takeAbandoned(ctx)
+
+	m.mu.Lock()
+	p := &pendingTx{
+		req:      req,
+		gasLimit: gasLimit * gasLimitPercent / 100,
+		gasPrice: m.capGasPrice(gasPrice),
+		sentAt:   block,
+	}
+	if replaced != nil {
+		// Replacing an abandoned transaction needs a bumped gas price.
+		p.nonce = replaced.nonce
+		if bumped := m.bump(replaced.gasPrice); bumped.Cmp(p.gasPrice) > 0 {
+			p.gasPrice = bumped
+		}
+	} else {
+		if !m.nonceLoaded {
+			if m.nonce, err = m.backend.PendingNonceAt(ctx, key.Address); err != nil {
+				m.mu.Unlock()
+				return common.Hash{}, fmt.Errorf("failed to get nonce %v", err)
+			}
+			m.nonceLoaded = true
+		}
+		p.nonce = m.nonce
+		m.nonce++
+	}
+	tx, err := m.sign(p)
+	if err != nil {
+		m.mu.Unlock()
+		return common.Hash{}, err
+	}
+	m.pending = append(m.pending, p)
+	m.mu.Unlock()
+
+	go m.broadcast(p, tx)
+	return tx.Hash(), nil
+}
+
+// takeAbandoned removes and returns the first abandoned transaction still
+// unmined, whose nonce is free to reuse, or nil.
+func (m *TxManager) takeAbandoned(ctx context.Context) *pendingTx {
+	for {
+		m.mu.Lock()
+		if len(m.abandoned) == 0 {
+			m.mu.Unlock()
+			return nil
+		}
+		p := m.abandoned[0]
+		m.abandoned = m.abandoned[1:]
+		m.mu.Unlock()
+		if m.receipt(ctx, p) == nil {
+			return p
+		}
+	}
+}
+
+// sign signs p at its current gas price and records the hash.
+func (m *TxManager) sign(p *pendingTx) (*types.Transaction, error) {
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{
+		Nonce:    p.nonce,
+		GasPrice: p.gasPrice,
+		Gas:      p.gasLimit,
+		To:       &p.req.To,
+		Data:     p.req.Data,
+	}), types.LatestSignerForChainID(m.chainID), m.walletService.Key.ToEcdsaPrivKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction %v", err)
+	}
+	p.hashes = append(p.hashes, tx.Hash())
+	p.tx = tx
+	return tx, nil
+}
+
+func (m *TxManager) broadcast(p *pendingTx, tx *types.Transaction) {
+	ctx, cancel := context.WithTimeout(context.Background(), broadcastTimeout)
+	defer cancel()
+	err := m.backend.SendTransaction(ctx, tx)
+	logger := m.logger.WithFields(logrus.Fields{
+		"Tx":        tx.Hash().Hex(),
+		"Nonce":     tx.Nonce(),
+		"Gas Price": tx.GasPrice(),
+	})
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p.tx == tx {
+		p.unsent = false
+	}
+	switch {
+	case err == nil:
+		logger.Info("Broadcast transaction")
+	case strings.Contains(err.Error(), "already known"):
+		// A rebroadcast of a transaction the node already holds.
+	case strings.Contains(err.Error(), "nonce too low"):
+		logger.Warnf("Nonce already used, resyncing %v", err)
+		p.nonceUsed = true
+		m.nonceLoaded = false
+		// The nonces of the abandoned transactions are unknown after a
+		// resync, the node's pending nonce counts them.
+		m.abandoned = nil
+	default:
+		// The later nonces wait for this one, the next check broadcasts it
+		// again.
+		logger.Errorf("failed to broadcast transaction %v", err)
+		if p.tx == tx {
+			p.unsent = true
+		}
+	}
+}
+
+func (m *TxManager) bump(gasPrice *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(100+m.cfg.BumpPercent))
+	return m.capGasPrice(bumped.Div(bumped, big.NewInt(100)))
+}
+
+func (m *TxManager) capGasPrice(gasPrice *big.Int) *big.Int {
+	if limit := m.cfg.MaxGasPrice.ToInt(); limit.Sign() > 0 && gasPrice.Cmp(limit) > 0 {
+		return new(big.Int).Set(limit)
+	}
+	return gasPrice
+}
+
+// Start checks the pending transactions every poll interval until ctx is
+// done.
+func (m *TxManager) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.PollInterval.D())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Check(ctx); err != nil {
+				m.logger.Errorf("failed to check pending transactions %v", err)
+			}
+		}
+	}
+}
+
+// Check finishes the mined, superseded and rejected pending transactions,
+// broadcasts again those a node failed to accept and bumps the gas price of
+// those unmined for too many blocks.
+func (m *TxManager) Check(ctx context.Context) error {
+	block, err := m.backend.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get block number %v", err)
+	}
+	m.mu.Lock()
+	pending := append([]*pendingTx(nil), m.pending...)
+	abandoned := append([]*pendingTx(nil), m.abandoned...)
+	m.mu.Unlock()
+
+	for _, p := range abandoned {
+		if receipt := m.receipt(ctx, p); receipt != nil {
+			m.remove(p)
+		}
+	}
+	for _, p := range pending {
+		if receipt := m.receipt(ctx, p); receipt != nil {
+			m.finish(p, receipt, nil)
+			continue
+		}
+		if p.req.Superseded != nil {
+			superseded, err := p.req.Superseded(ctx)
+			if err != nil {
+				m.logger.Errorf("failed to check if transaction is superseded %v", err)
+			} else if superseded {
+				m.mu.Lock()
+				m.abandoned = append(m.abandoned, p)
+				m.mu.Unlock()
+				m.finish(p, nil, ErrSuperseded)
+				continue
+			}
+		}
+		m.mu.Lock()
+		if p.nonceUsed {
+			m.mu.Unlock()
+			m.finish(p, nil, fmt.Errorf("nonce %d was used by another transaction", p.nonce))
+			continue
+		}
+		if block < p.sentAt+m.cfg.BumpAfterBlocks {
+			tx := p.tx
+			unsent := p.unsent
+			m.mu.Unlock()
+			if unsent {
+				go m.broadcast(p, tx)
+			}
+			continue
+		}
+		p.gasPrice = m.bump(p.gasPrice)
+		p.sentAt = block
+		tx, err := m.sign(p)
+		m.mu.Unlock()
+		if err != nil {
+			m.logger.Errorf("failed to bump transaction %v", err)
+			continue
+		}
+		m.logger.WithFields(logrus.Fields{
+			"Tx":        tx.Hash().Hex(),
+			"Nonce":     tx.Nonce(),
+			"Gas Price": tx.GasPrice(),
+		}).Warn("Transaction not mined, bumping gas price")
+		go m.broadcast(p, tx)
+	}
+	return nil
+}
+
+// receipt returns the receipt of any broadcast of p, nil while none is mined.
+func (m *TxManager) receipt(ctx context.Context, p *pendingTx) *types.Receipt {
+	m.mu.Lock()
+	hashes := append([]common.Hash(nil), p.hashes...)
+	m.mu.Unlock()
+	for _, hash := range hashes {
+		if receipt, err := m.backend.TransactionReceipt(ctx, hash); err == nil && receipt != nil {
+			return receipt
+		}
+	}
+	return nil
+}
+
+func (m *TxManager) finish(p *pendingTx, receipt *types.Receipt, err error) {
+	m.mu.Lock()
+	m.pending = without(m.pending, p)
+	m.mu.Unlock()
+	if p.req.OnDone != nil {
+		p.req.OnDone(receipt, err)
+	}
+}
+
+func (m *TxManager) remove(p *pendingTx) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.abandoned = without(m.abandoned, p)
+}
+
+func without(txs []*pendingTx, p *pendingTx) []*pendingTx {
+	kept := txs[:0]
+	for _, tx := range txs {
+		if tx != p {
+			kept = append(kept, tx)
+		}
+	}
+	return kept
+}
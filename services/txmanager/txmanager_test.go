@@ -0,0 +1,286 @@
+package txmanager
+
+import (
+	"context"
+	"erinaceus_data_feeds/config"
+	"erinaceus_data_feeds/keys/ethkey"
+	wallet_service "erinaceus_data_feeds/services/wallet"
+	ubig "erinaceus_data_feeds/utils/big"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend is a node mining the transactions it is told to.
+type fakeBackend struct {
+	mu         sync.Mutex
+	nonce      uint64
+	nonceReads int
+	block      uint64
+	sent       []*types.Transaction
+	sendErr    error
+	receipts   map[common.Hash]*types.Receipt
+}
+
+func (b *fakeBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nonceReads++
+	return b.nonce, nil
+}
+
+func (b *fakeBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(100), nil
+}
+
+func (b *fakeBackend) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	return 100000, nil
+}
+
+func (b *fakeBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sent = append(b.sent, tx)
+	return b.sendErr
+}
+
+func (b *fakeBackend) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if receipt, ok := b.receipts[hash]; ok {
+		return receipt, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (b *fakeBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.block, nil
+}
+
+func (b *fakeBackend) mine(hash common.Hash) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.receipts[hash] = &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: hash}
+}
+
+func (b *fakeBackend) advance(blocks uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.block += blocks
+}
+
+// waitSent waits for n broadcasts and returns them.
+func (b *fakeBackend) waitSent(t *testing.T, n int) []*types.Transaction {
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.sent) >= n
+	}, time.Second, time.Millisecond)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*types.Transaction(nil), b.sent...)
+}
+
+func newTestTxManager(t *testing.T, cfg config.TxManager) (*TxManager, *fakeBackend) {
+	key, err := ethkey.NewV2()
+	require.NoError(t, err)
+	backend := &fakeBackend{nonce: 7, block: 100, receipts: make(map[common.Hash]*types.Receipt)}
+	return NewTxManager(backend, 4090, cfg, &wallet_service.WalletService{Key: key}, logrus.New()), backend
+}
+
+type result struct {
+	receipt *types.Receipt
+	err     error
+}
+
+func request(results chan<- result, superseded *bool) Request {
+	return Request{
+		To:   common.HexToAddress("0x46C35E26653eB21A474E74887a9CFB0e61620175"),
+		Data: []byte{1},
+		Superseded: func(ctx context.Context) (bool, error) {
+			return superseded != nil && *superseded, nil
+		},
+		OnDone: func(receipt *types.Receipt, err error) { results <- result{receipt, err} },
+	}
+}
+
+func TestSendTracksNonces(t *testing.T) {
+	m, backend := newTestTxManager(t, config.TxManager{BumpAfterBlocks: 3, BumpPercent: 20})
+	results := make(chan result, 2)
+	first, err := m.Send(context.Background(), request(results, nil))
+	require.NoError(t, err)
+	second, err := m.Send(context.Background(), request(results, nil))
+	require.NoError(t, err)
+
+	sent := backend.waitSent(t, 2)
+	nonces := []uint64{sent[0].Nonce(), sent[1].Nonce()}
+	assert.ElementsMatch(t, []uint64{7, 8}, nonces)
+	assert.Equal(t, 1, backend.nonceReads)
+	assert.Equal(t, uint64(120000), sent[0].Gas())
+
+	backend.mine(first)
+	require.NoError(t, m.Check(context.Background()))
+	done := <-results
+	require.NoError(t, done.err)
+	assert.Equal(t, first, done.receipt.TxHash)
+	assert.Len(t, m.pending, 1)
+
+	backend.mine(second)
+	require.NoError(t, m.Check(context.Background()))
+	assert.Equal(t, second, (<-results).receipt.TxHash)
+	assert.Empty(t, m.pending)
+}
+
+func TestBumpsGasPriceOfStuckTransactions(t *testing.T) {
+	m, backend := newTestTxManager(t, config.TxManager{BumpAfterBlocks: 3, BumpPercent: 20, MaxGasPrice: *ubig.NewI(130)})
+	results := make(chan result, 1)
+	_, err := m.Send(context.Background(), request(results, nil))
+	require.NoError(t, err)
+	backend.waitSent(t, 1)
+
+	backend.advance(2)
+	require.NoError(t, m.Check(context.Background()))
+	backend.advance(1)
+	require.NoError(t, m.Check(context.Background()))
+	sent := backend.waitSent(t, 2)
+	assert.Equal(t, sent[0].Nonce(), sent[1].Nonce())
+	assert.Equal(t, big.NewInt(120), sent[1].GasPrice())
+
+	backend.advance(3)
+	require.NoError(t, m.Check(context.Background()))
+	sent = backend.waitSent(t, 3)
+	assert.Equal(t, big.NewInt(130), sent[2].GasPrice(), "capped by the max gas price")
+
+	// The first broadcast is mined after all.
+	backend.mine(sent[0].Hash())
+	require.NoError(t, m.Check(context.Background()))
+	done := <-results
+	require.NoError(t, done.err)
+	assert.Equal(t, sent[0].Hash(), done.receipt.TxHash)
+}
+
+func TestGivesUpOnSupersededTransactions(t *testing.T) {
+	m, backend := newTestTxManager(t, config.TxManager{BumpAfterBlocks: 3, BumpPercent: 20})
+	results := make(chan result, 2)
+	superseded := false
+	_, err := m.Send(context.Background(), request(results, &superseded))
+	require.NoError(t, err)
+	stuck := backend.waitSent(t, 1)[0]
+
+	superseded = true
+	require.NoError(t, m.Check(context.Background()))
+	assert.ErrorIs(t, (<-results).err, ErrSuperseded)
+	assert.Empty(t, m.pending)
+
+	// The next transaction replaces the abandoned one.
+	_, err = m.Send(context.Background(), request(results, nil))
+	require.NoError(t, err)
+	replacement := backend.waitSent(t, 2)[1]
+	assert.Equal(t, stuck.Nonce(), replacement.Nonce())
+	assert.Equal(t, big.NewInt(120), replacement.GasPrice())
+}
+
+func TestResyncsRejectedNonces(t *testing.T) {
+	m, backend := newTestTxManager(t, config.TxManager{BumpAfterBlocks: 3, BumpPercent: 20})
+	backend.sendErr = errors.New("nonce too low: next nonce 9, tx nonce 7")
+	results := make(chan result, 1)
+	_, err := m.Send(context.Background(), request(results, nil))
+	require.NoError(t, err)
+	backend.waitSent(t, 1)
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return !m.nonceLoaded
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, m.Check(context.Background()))
+	assert.ErrorContains(t, (<-results).err, "nonce 7 was used by another transaction")
+
+	backend.sendErr = nil
+	backend.nonce = 9
+	_, err = m.Send(context.Background(), request(results, nil))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(9), backend.waitSent(t, 2)[1].Nonce())
+	assert.Equal(t, 2, backend.nonceReads)
+}
+
+func TestSkipsAbandonedNoncesMinedSince(t *testing.T) {
+	m, backend := newTestTxManager(t, config.TxManager{BumpAfterBlocks: 3, BumpPercent: 20})
+	results := make(chan result, 2)
+	superseded := false
+	_, err := m.Send(context.Background(), request(results, &superseded))
+	require.NoError(t, err)
+	stuck := backend.waitSent(t, 1)[0]
+	superseded = true
+	require.NoError(t, m.Check(context.Background()))
+	assert.ErrorIs(t, (<-results).err, ErrSuperseded)
+
+	// Mined before the next check dropped it.
+	backend.mine(stuck.Hash())
+	_, err = m.Send(context.Background(), request(results, nil))
+	require.NoError(t, err)
+	assert.Equal(t, stuck.Nonce()+1, backend.waitSent(t, 2)[1].Nonce())
+	assert.Empty(t, m.abandoned)
+}
+
+func TestResyncDropsAbandonedNonces(t *testing.T) {
+	m, backend := newTestTxManager(t, config.TxManager{BumpAfterBlocks: 3, BumpPercent: 20})
+	results := make(chan result, 3)
+	superseded := false
+	for i := 0; i < 2; i++ {
+		_, err := m.Send(context.Background(), request(results, &superseded))
+		require.NoError(t, err)
+	}
+	backend.waitSent(t, 2)
+	superseded = true
+	require.NoError(t, m.Check(context.Background()))
+	require.Len(t, m.abandoned, 2)
+
+	backend.mu.Lock()
+	backend.sendErr = errors.New("nonce too low")
+	backend.mu.Unlock()
+	_, err := m.Send(context.Background(), request(results, nil))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return !m.nonceLoaded && len(m.abandoned) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestRebroadcastsFailedBroadcasts(t *testing.T) {
+	m, backend := newTestTxManager(t, config.TxManager{BumpAfterBlocks: 3, BumpPercent: 20})
+	backend.sendErr = errors.New("connection refused")
+	results := make(chan result, 1)
+	_, err := m.Send(context.Background(), request(results, nil))
+	require.NoError(t, err)
+	backend.waitSent(t, 1)
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.pending[0].unsent
+	}, time.Second, time.Millisecond)
+
+	backend.mu.Lock()
+	backend.sendErr = nil
+	backend.mu.Unlock()
+	require.NoError(t, m.Check(context.Background()))
+	sent := backend.waitSent(t, 2)
+	assert.Equal(t, sent[0].Hash(), sent[1].Hash(), "same transaction before any block passed")
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return !m.pending[0].unsent
+	}, time.Second, time.Millisecond)
+}
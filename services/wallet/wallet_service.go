@@ -3,35 +3,35 @@ package wallet_service
 import (
 	"context"
 	"erinaceus_data_feeds/client"
+	"erinaceus_data_feeds/config"
 	"erinaceus_data_feeds/keys/ethkey"
 	"erinaceus_data_feeds/utils"
 	"fmt"
 	"math/big"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/sirupsen/logrus"
 )
 
-var basepath, _ = os.Getwd()
-
 type WalletService struct {
 	Client *client.Client
 	Key    ethkey.KeyV2
+	keys   config.Keys
 }
 
-func NewWalletService(client *client.Client) *WalletService {
+func NewWalletService(client *client.Client, keys config.Keys) *WalletService {
 	logrus.Info("Starting Wallet Service ....\n")
 	time.Sleep(1 * time.Second)
 	return &WalletService{
 		Client: client,
+		keys:   keys,
 	}
 }
 
 func (w *WalletService) CreateNewFTNKey() (ethkey.KeyV2, error) {
-	ethKey, err := ethkey.GetKeyIfEnvSet()
+	ethKey, err := ethkey.GetKeyFromFile(w.keys.JSONPath, w.keys.Password)
 	if err != nil {
 		return ethkey.KeyV2{}, err
 	}
@@ -49,13 +49,16 @@ func (w *WalletService) CreateNewFTNKey() (ethkey.KeyV2, error) {
 	}
 
 	w.Key = key
-	keyJSON, err := key.ToEncryptedJSON(os.Getenv("EC_FTN_KEY_PASSWORD"), utils.FastScryptParams)
+	keyJSON, err := key.ToEncryptedJSON(w.keys.Password, utils.FastScryptParams)
 	if err != nil {
 		logrus.Errorf("Failed to encrypt key: %v", err)
 		return ethkey.KeyV2{}, err
 	}
 
-	keyFilePath := filepath.Join(basepath, "ftn_key.json")
+	keyFilePath := w.keys.JSONPath
+	if keyFilePath == "" {
+		keyFilePath = "ftn_key.json"
+	}
 	if err := os.WriteFile(keyFilePath, keyJSON, 0644); err != nil {
 		logrus.Errorf("Failed to write key file: %v", err)
 		return ethkey.KeyV2{}, err
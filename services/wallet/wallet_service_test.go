@@ -2,6 +2,7 @@ package wallet_service
 
 import (
 	"erinaceus_data_feeds/client"
+	"erinaceus_data_feeds/config"
 	"math/big"
 	"os"
 	"testing"
@@ -11,7 +12,7 @@ import (
 
 func TestNewWalletService(t *testing.T) {
 	mockClient := &client.Client{}
-	walletService := NewWalletService(mockClient)
+	walletService := NewWalletService(mockClient, config.Keys{})
 
 	if *walletService.Client != *mockClient {
 		t.Errorf("Client was not set correctly in NewWalletService")
@@ -24,7 +25,7 @@ func TestCreateNewFTNKey(t *testing.T) {
 	os.Chdir(tmpDir)
 
 	mockClient := &client.Client{} // Initialize your client mock
-	walletService := NewWalletService(mockClient)
+	walletService := NewWalletService(mockClient, config.Keys{Password: "testpassword"})
 
 	// Clear environment variable to simulate the key not being set
 	os.Unsetenv("EC_FTN_KEY_JSON")
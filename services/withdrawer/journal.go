@@ -0,0 +1,60 @@
+package withdrawer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Withdrawal states recorded in the journal.
+const (
+	StatusSent     = "sent"
+	StatusMined    = "mined"
+	StatusReverted = "reverted"
+	StatusFailed   = "failed"
+)
+
+// Entry is a line of the journal, recorded when a withdrawal is sent and
+// again once it is mined or given up on.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Feed     string    `json:"feed"`
+	Contract string    `json:"contract"`
+	Oracle   string    `json:"oracle"`
+	Payee    string    `json:"payee"`
+	Amount   string    `json:"amount"`
+	Tx       string    `json:"tx"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Journal appends withdrawals to a file of JSON lines.
+type Journal struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewJournal(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Record appends entry to the journal.
+func (j *Journal) Record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal %s: %v", j.path, err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write journal %s: %v", j.path, err)
+	}
+	return file.Close()
+}
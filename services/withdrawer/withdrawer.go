@@ -0,0 +1,214 @@
+package withdrawer
+
+import (
+	"context"
+	"erinaceus_data_feeds/client"
+	"erinaceus_data_feeds/config"
+	aggregator "erinaceus_data_feeds/contract"
+	"erinaceus_data_feeds/services/txmanager"
+	wallet_service "erinaceus_data_feeds/services/wallet"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+// payments is the part of the aggregator binding paying the oracles.
+type payments interface {
+	WithdrawablePayment(opts *bind.CallOpts, oracle common.Address) (*big.Int, error)
+}
+
+// sender sends transactions, implemented by txmanager.TxManager.
+type sender interface {
+	Send(ctx context.Context, req txmanager.Request) (common.Hash, error)
+}
+
+type feed struct {
+	name     string
+	address  common.Address
+	contract payments
+}
+
+// Withdrawer withdraws the payments the oracle earned on every feed once they
+// exceed the configured threshold.
+type Withdrawer struct {
+	cfg           config.Withdrawal
+	walletService *wallet_service.WalletService
+	sender        sender
+	abi           abi.ABI
+	feeds         []feed
+	journal       *Journal
+	logger        *logrus.Logger
+
+	mu sync.Mutex
+	// pending are the feeds with a withdrawal not mined yet.
+	pending map[common.Address]bool
+}
+
+func NewWithdrawer(client *client.Client, cfg config.Withdrawal, feeds []config.Feed, walletService *wallet_service.WalletService, txManager *txmanager.TxManager, logger *logrus.Logger) (*Withdrawer, error) {
+	parsedABI, err := abi.JSON(strings.NewReader(aggregator.AggregatorABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse aggregator abi %v", err)
+	}
+	w := &Withdrawer{
+		cfg:           cfg,
+		walletService: walletService,
+		sender:        txManager,
+		abi:           parsedABI,
+		journal:       NewJournal(cfg.JournalPath),
+		logger:        logger,
+		pending:       make(map[common.Address]bool),
+	}
+	for _, feedCfg := range feeds {
+		contract, err := aggregator.NewAggregator(feedCfg.ContractAddress(), client.EthClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to bind aggregator of feed %s %v", feedCfg.Name, err)
+		}
+		w.feeds = append(w.feeds, feed{name: feedCfg.Name, address: feedCfg.ContractAddress(), contract: contract})
+	}
+	return w, nil
+}
+
+// Start checks every feed each interval, until ctx is done.
+func (w *Withdrawer) Start(ctx context.Context) {
+	w.logger.WithFields(logrus.Fields{
+		"Interval":  w.cfg.Interval.String(),
+		"Threshold": w.cfg.Threshold.String(),
+		"Payee":     w.payee().Hex(),
+	}).Info("Starting withdrawer")
+	ticker := time.NewTicker(w.cfg.Interval.D())
+	defer ticker.Stop()
+	for {
+		w.WithdrawAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// WithdrawAll withdraws the payment of every feed above the threshold. A
+// failing feed does not stop the others.
+func (w *Withdrawer) WithdrawAll(ctx context.Context) {
+	for _, f := range w.feeds {
+		if err := w.withdraw(ctx, f); err != nil {
+			w.logger.WithField("feed", f.name).Errorf("failed to withdraw payment %v", err)
+		}
+	}
+}
+
+// payee returns the configured payee, or the transmitter.
+func (w *Withdrawer) payee() common.Address {
+	if w.cfg.Payee != "" {
+		return common.HexToAddress(w.cfg.Payee)
+	}
+	return w.walletService.Key.Address
+}
+
+func (w *Withdrawer) withdraw(ctx context.Context, f feed) error {
+	oracle := w.walletService.Key.Address
+	amount, err := f.contract.WithdrawablePayment(&bind.CallOpts{Context: ctx}, oracle)
+	if err != nil {
+		return fmt.Errorf("failed to get withdrawable payment %v", err)
+	}
+	logger := w.logger.WithFields(logrus.Fields{
+		"feed":      f.name,
+		"Amount":    amount,
+		"Threshold": w.cfg.Threshold.String(),
+	})
+	if amount.Sign() == 0 || amount.Cmp(w.cfg.Threshold.ToInt()) <= 0 {
+		logger.Debug("Withdrawable payment below threshold")
+		return nil
+	}
+	w.mu.Lock()
+	if w.pending[f.address] {
+		w.mu.Unlock()
+		logger.Debug("Withdrawal already pending")
+		return nil
+	}
+	w.pending[f.address] = true
+	w.mu.Unlock()
+
+	payee := w.payee()
+	entry := Entry{
+		Feed:     f.name,
+		Contract: f.address.Hex(),
+		Oracle:   oracle.Hex(),
+		Payee:    payee.Hex(),
+		Amount:   amount.String(),
+	}
+	data, err := w.abi.Pack("withdrawPayment", oracle, payee, amount)
+	if err != nil {
+		w.done(f)
+		return fmt.Errorf("failed to pack withdrawal %v", err)
+	}
+	// The outcome is recorded after the sent entry, whenever it comes.
+	sent := make(chan Entry, 1)
+	tx, err := w.sender.Send(ctx, txmanager.Request{
+		To:   f.address,
+		Data: data,
+		OnDone: func(receipt *types.Receipt, err error) {
+			w.mined(f, <-sent, receipt, err, logger)
+		},
+	})
+	if err != nil {
+		w.done(f)
+		return fmt.Errorf("failed to send withdrawal %v", err)
+	}
+	entry.Time = time.Now().UTC()
+	entry.Tx = tx.Hex()
+	entry.Status = StatusSent
+	if err := w.journal.Record(entry); err != nil {
+		logger.Errorf("failed to record withdrawal %v", err)
+	}
+	sent <- entry
+	logger.WithFields(logrus.Fields{
+		"Payee": payee.Hex(),
+		"Tx":    tx.Hex(),
+	}).Info("Withdrawing payment")
+	return nil
+}
+
+// mined records the outcome of the withdrawal of entry: mined, reverted, or
+// failed when the tx manager gave up on it.
+func (w *Withdrawer) mined(f feed, entry Entry, receipt *types.Receipt, err error, logger *logrus.Entry) {
+	defer w.done(f)
+	entry.Time = time.Now().UTC()
+	switch {
+	case err != nil:
+		entry.Status = StatusFailed
+		entry.Error = err.Error()
+	case receipt.Status != types.ReceiptStatusSuccessful:
+		entry.Tx = receipt.TxHash.Hex()
+		entry.Status = StatusReverted
+	default:
+		entry.Tx = receipt.TxHash.Hex()
+		entry.Status = StatusMined
+	}
+	if err := w.journal.Record(entry); err != nil {
+		logger.Errorf("failed to record withdrawal %v", err)
+	}
+	if entry.Status == StatusFailed {
+		logger.WithField("Tx", entry.Tx).Errorf("failed to withdraw payment %v", err)
+		return
+	}
+	if entry.Status == StatusReverted {
+		logger.WithField("Tx", entry.Tx).Error("Withdrawal reverted")
+		return
+	}
+	logger.WithField("Tx", entry.Tx).Info("Payment withdrawn")
+}
+
+func (w *Withdrawer) done(f feed) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.pending, f.address)
+}
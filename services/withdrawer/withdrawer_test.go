@@ -0,0 +1,163 @@
+package withdrawer
+
+import (
+	"context"
+	"encoding/json"
+	"erinaceus_data_feeds/config"
+	aggregator "erinaceus_data_feeds/contract"
+	"erinaceus_data_feeds/keys/ethkey"
+	"erinaceus_data_feeds/services/txmanager"
+	wallet_service "erinaceus_data_feeds/services/wallet"
+	ubig "erinaceus_data_feeds/utils/big"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePayments struct {
+	withdrawable *big.Int
+}
+
+func (p *fakePayments) WithdrawablePayment(opts *bind.CallOpts, oracle common.Address) (*big.Int, error) {
+	return p.withdrawable, nil
+}
+
+// fakeSender holds the requests sent until mine is called.
+type fakeSender struct {
+	requests []txmanager.Request
+	hashes   []common.Hash
+}
+
+func (s *fakeSender) Send(ctx context.Context, req txmanager.Request) (common.Hash, error) {
+	hash := common.BigToHash(big.NewInt(int64(len(s.requests) + 1)))
+	s.requests = append(s.requests, req)
+	s.hashes = append(s.hashes, hash)
+	return hash, nil
+}
+
+// mine mines every request sent with status.
+func (s *fakeSender) mine(status uint64) {
+	for i, req := range s.requests {
+		req.OnDone(&types.Receipt{Status: status, TxHash: s.hashes[i]}, nil)
+	}
+	s.requests, s.hashes = nil, nil
+}
+
+func newTestWithdrawer(t *testing.T, cfg config.Withdrawal, feeds ...feed) (*Withdrawer, *fakeSender) {
+	key, err := ethkey.NewV2()
+	require.NoError(t, err)
+	parsedABI, err := abi.JSON(strings.NewReader(aggregator.AggregatorABI))
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	return &Withdrawer{
+		cfg:           cfg,
+		walletService: &wallet_service.WalletService{Key: key},
+		sender:        sender,
+		abi:           parsedABI,
+		feeds:         feeds,
+		journal:       NewJournal(cfg.JournalPath),
+		logger:        logrus.New(),
+		pending:       make(map[common.Address]bool),
+	}, sender
+}
+
+// withdrawal unpacks the payee and amount of a withdrawPayment request.
+func withdrawal(t *testing.T, w *Withdrawer, req txmanager.Request) (common.Address, *big.Int) {
+	args, err := w.abi.Methods["withdrawPayment"].Inputs.Unpack(req.Data[4:])
+	require.NoError(t, err)
+	require.Equal(t, w.walletService.Key.Address, args[0])
+	return args[1].(common.Address), args[2].(*big.Int)
+}
+
+func readJournal(t *testing.T, path string) []Entry {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var entries []Entry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry Entry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestWithdrawAboveThreshold(t *testing.T) {
+	payee := common.HexToAddress("0x46C35E26653eB21A474E74887a9CFB0e61620175")
+	cfg := config.Withdrawal{
+		Threshold:   *ubig.New(big.NewInt(100)),
+		Payee:       payee.Hex(),
+		JournalPath: filepath.Join(t.TempDir(), "withdrawals.jsonl"),
+	}
+	w, sender := newTestWithdrawer(t, cfg,
+		feed{name: "below", address: common.HexToAddress("0x02"), contract: &fakePayments{withdrawable: big.NewInt(100)}},
+		feed{name: "above", address: common.HexToAddress("0x01"), contract: &fakePayments{withdrawable: big.NewInt(101)}},
+	)
+
+	w.WithdrawAll(context.Background())
+	require.Len(t, sender.requests, 1)
+	assert.Equal(t, common.HexToAddress("0x01"), sender.requests[0].To)
+	to, amount := withdrawal(t, w, sender.requests[0])
+	assert.Equal(t, payee, to)
+	assert.Equal(t, big.NewInt(101), amount)
+
+	w.WithdrawAll(context.Background())
+	assert.Len(t, sender.requests, 1, "withdrawal already pending")
+
+	sender.mine(types.ReceiptStatusSuccessful)
+	entries := readJournal(t, cfg.JournalPath)
+	require.Len(t, entries, 2)
+	for i, status := range []string{StatusSent, StatusMined} {
+		assert.Equal(t, "above", entries[i].Feed)
+		assert.Equal(t, common.HexToAddress("0x01").Hex(), entries[i].Contract)
+		assert.Equal(t, w.walletService.Key.Address.Hex(), entries[i].Oracle)
+		assert.Equal(t, payee.Hex(), entries[i].Payee)
+		assert.Equal(t, "101", entries[i].Amount)
+		assert.Equal(t, status, entries[i].Status)
+	}
+	assert.Equal(t, entries[0].Tx, entries[1].Tx)
+	assert.Empty(t, w.pending)
+}
+
+func TestWithdrawToTransmitterAndRevert(t *testing.T) {
+	cfg := config.Withdrawal{JournalPath: filepath.Join(t.TempDir(), "withdrawals.jsonl")}
+	payments := &fakePayments{withdrawable: big.NewInt(1)}
+	w, sender := newTestWithdrawer(t, cfg, feed{name: "xrp", contract: payments})
+
+	require.NoError(t, w.withdraw(context.Background(), w.feeds[0]))
+	require.Len(t, sender.requests, 1)
+	to, _ := withdrawal(t, w, sender.requests[0])
+	assert.Equal(t, w.walletService.Key.Address, to)
+	sender.mine(types.ReceiptStatusFailed)
+	entries := readJournal(t, cfg.JournalPath)
+	require.Len(t, entries, 2)
+	assert.Equal(t, StatusReverted, entries[1].Status)
+
+	payments.withdrawable = big.NewInt(0)
+	require.NoError(t, w.withdraw(context.Background(), w.feeds[0]))
+	assert.Empty(t, sender.requests, "nothing to withdraw")
+}
+
+func TestWithdrawalGivenUp(t *testing.T) {
+	cfg := config.Withdrawal{JournalPath: filepath.Join(t.TempDir(), "withdrawals.jsonl")}
+	w, sender := newTestWithdrawer(t, cfg, feed{name: "xrp", contract: &fakePayments{withdrawable: big.NewInt(1)}})
+
+	require.NoError(t, w.withdraw(context.Background(), w.feeds[0]))
+	require.Len(t, sender.requests, 1)
+	sender.requests[0].OnDone(nil, txmanager.ErrSuperseded)
+	entries := readJournal(t, cfg.JournalPath)
+	require.Len(t, entries, 2)
+	assert.Equal(t, StatusFailed, entries[1].Status)
+	assert.Equal(t, entries[0].Tx, entries[1].Tx)
+	assert.Equal(t, txmanager.ErrSuperseded.Error(), entries[1].Error)
+	assert.Empty(t, w.pending, "withdrawn again on the next check")
+}
@@ -0,0 +1,74 @@
+package redact
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mask replaces every redacted secret.
+const Mask = "[REDACTED]"
+
+// Redactor masks known secrets in text, in their raw and URL-escaped forms.
+type Redactor struct {
+	replacer *strings.Replacer
+}
+
+// New returns a Redactor for secrets. Empty secrets are ignored.
+func New(secrets ...string) *Redactor {
+	seen := make(map[string]bool)
+	var forms []string
+	for _, secret := range secrets {
+		for _, form := range []string{secret, url.QueryEscape(secret), url.PathEscape(secret)} {
+			if form != "" && !seen[form] {
+				seen[form] = true
+				forms = append(forms, form)
+			}
+		}
+	}
+	// Longer secrets first, so that a secret containing another one is
+	// masked whole.
+	sort.Slice(forms, func(i, j int) bool { return len(forms[i]) > len(forms[j]) })
+	var pairs []string
+	for _, form := range forms {
+		pairs = append(pairs, form, Mask)
+	}
+	return &Redactor{replacer: strings.NewReplacer(pairs...)}
+}
+
+// String returns s with every secret masked.
+func (r *Redactor) String(s string) string {
+	return r.replacer.Replace(s)
+}
+
+// Hook masks secrets in the message and fields of every log entry.
+type Hook struct {
+	redactor *Redactor
+}
+
+// NewHook returns a logrus hook masking secrets.
+func NewHook(secrets ...string) *Hook {
+	return &Hook{redactor: New(secrets...)}
+}
+
+func (h *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.redactor.String(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = h.redactor.String(v)
+		case error:
+			entry.Data[key] = h.redactor.String(v.Error())
+		case fmt.Stringer:
+			entry.Data[key] = h.redactor.String(v.String())
+		}
+	}
+	return nil
+}
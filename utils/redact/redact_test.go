@@ -0,0 +1,31 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor(t *testing.T) {
+	r := New("s3cr3t", "a b&c", "")
+	assert.Equal(t, "key=[REDACTED] q=[REDACTED] p=[REDACTED]", r.String("key=s3cr3t q=a+b%26c p=a%20b&c"))
+	assert.Equal(t, "nothing to hide", r.String("nothing to hide"))
+}
+
+func TestHook(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.AddHook(NewHook("s3cr3t"))
+
+	logger.WithFields(logrus.Fields{
+		"url":   "https://example.org/price?api_key=s3cr3t",
+		"error": errors.New(`Get "https://example.org/?api_key=s3cr3t": timeout`),
+	}).Errorf("failed with key %s", "s3cr3t")
+
+	assert.NotContains(t, out.String(), "s3cr3t")
+	assert.Contains(t, out.String(), Mask)
+}
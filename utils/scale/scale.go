@@ -0,0 +1,92 @@
+package scale
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/shopspring/decimal"
+)
+
+// RoundingMode selects how a price with more fractional digits than the feed
+// decimals is turned into an integer answer.
+type RoundingMode string
+
+const (
+	// RoundHalfUp rounds to the nearest integer, halves away from zero.
+	RoundHalfUp RoundingMode = "half_up"
+	// RoundHalfEven rounds to the nearest integer, halves to the even one.
+	RoundHalfEven RoundingMode = "half_even"
+	// RoundDown truncates towards zero.
+	RoundDown RoundingMode = "down"
+	// RoundUp rounds away from zero.
+	RoundUp RoundingMode = "up"
+	// RoundFloor rounds towards negative infinity.
+	RoundFloor RoundingMode = "floor"
+	// RoundCeil rounds towards positive infinity.
+	RoundCeil RoundingMode = "ceil"
+)
+
+// DefaultRoundingMode is used when a feed does not configure one.
+const DefaultRoundingMode = RoundHalfUp
+
+// DivisionPrecision is the number of fractional digits kept when prices are
+// divided. It exceeds the 18 decimals of any aggregator so that rounding to
+// the submitted answer stays the only rounding that matters.
+const DivisionPrecision = 24
+
+// maxAnswer bounds the int256 answers an aggregator accepts.
+var maxAnswer = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1))
+var minAnswer = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 255))
+
+// ParseRoundingMode returns the rounding mode named s. An empty string selects
+// DefaultRoundingMode.
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	switch mode := RoundingMode(s); mode {
+	case "":
+		return DefaultRoundingMode, nil
+	case RoundHalfUp, RoundHalfEven, RoundDown, RoundUp, RoundFloor, RoundCeil:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown rounding mode %q, expected one of half_up, half_even, down, up, floor, ceil", s)
+	}
+}
+
+// Round rounds d to an integer using the rounding mode.
+func (m RoundingMode) Round(d decimal.Decimal) decimal.Decimal {
+	switch m {
+	case RoundHalfEven:
+		return d.RoundBank(0)
+	case RoundDown:
+		return d.RoundDown(0)
+	case RoundUp:
+		return d.RoundUp(0)
+	case RoundFloor:
+		return d.RoundFloor(0)
+	case RoundCeil:
+		return d.RoundCeil(0)
+	default:
+		return d.Round(0)
+	}
+}
+
+// ToSubmission converts price into the integer answer submitted to an
+// aggregator with the given decimals: price * 10^decimals, rounded with mode.
+// It fails when the answer does not fit in an int256.
+func ToSubmission(price decimal.Decimal, decimals uint8, mode RoundingMode) (*big.Int, error) {
+	answer := mode.Round(price.Shift(int32(decimals))).BigInt()
+	if answer.Cmp(maxAnswer) > 0 || answer.Cmp(minAnswer) < 0 {
+		return nil, fmt.Errorf("price %s with %d decimals overflows int256", price, decimals)
+	}
+	return answer, nil
+}
+
+// FromSubmission converts an on-chain answer back into a price.
+func FromSubmission(answer *big.Int, decimals uint8) decimal.Decimal {
+	return decimal.NewFromBigInt(answer, -int32(decimals))
+}
+
+// Div divides a by b, keeping DivisionPrecision fractional digits. b must not
+// be zero.
+func Div(a, b decimal.Decimal) decimal.Decimal {
+	return a.DivRound(b, DivisionPrecision)
+}
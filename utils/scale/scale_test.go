@@ -0,0 +1,72 @@
+package scale
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToSubmission(t *testing.T) {
+	tests := []struct {
+		price    string
+		decimals uint8
+		mode     RoundingMode
+		want     string
+	}{
+		{"0.5234", 2, RoundHalfUp, "52"},
+		{"0.525", 2, RoundHalfUp, "53"},
+		{"0.525", 2, RoundHalfEven, "52"},
+		{"0.535", 2, RoundHalfEven, "54"},
+		{"0.529", 2, RoundDown, "52"},
+		{"0.521", 2, RoundUp, "53"},
+		{"-0.525", 2, RoundHalfUp, "-53"},
+		{"-0.529", 2, RoundDown, "-52"},
+		{"-0.521", 2, RoundFloor, "-53"},
+		{"-0.529", 2, RoundCeil, "-52"},
+		{"123456789.123456789", 8, RoundHalfUp, "12345678912345679"},
+		{"123456789.123456789", 18, RoundHalfUp, "123456789123456789000000000"},
+		{"0.000001234567891", 18, RoundHalfUp, "1234567891000"},
+		{"42", 0, RoundHalfUp, "42"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.price+"/"+string(tc.mode), func(t *testing.T) {
+			got, err := ToSubmission(decimal.RequireFromString(tc.price), tc.decimals, tc.mode)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got.String())
+		})
+	}
+}
+
+func TestToSubmissionOverflow(t *testing.T) {
+	huge := decimal.RequireFromString("1" + strings.Repeat("0", 77))
+	_, err := ToSubmission(huge, 18, RoundHalfUp)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "overflows int256")
+}
+
+func TestFromSubmission(t *testing.T) {
+	answer, _ := new(big.Int).SetString("12345678912345678900", 10)
+	assert.Equal(t, "123456789.123456789", FromSubmission(answer, 11).String())
+}
+
+func TestParseRoundingMode(t *testing.T) {
+	mode, err := ParseRoundingMode("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRoundingMode, mode)
+
+	mode, err = ParseRoundingMode("half_even")
+	require.NoError(t, err)
+	assert.Equal(t, RoundHalfEven, mode)
+
+	_, err = ParseRoundingMode("nearest")
+	require.Error(t, err)
+}
+
+func TestDiv(t *testing.T) {
+	assert.Equal(t, "0.333333333333333333333333", Div(decimal.NewFromInt(1), decimal.NewFromInt(3)).String())
+	assert.Equal(t, "0.000000000000000001", Div(decimal.RequireFromString("0.000000000000000002"), decimal.NewFromInt(2)).String())
+}
@@ -0,0 +1,292 @@
+package schedule
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the activation times of a recurring job.
+type Schedule interface {
+	// Next returns the first activation strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// Every activates at a fixed interval from the previous activation.
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+
+// Parse reads "@every <duration>", a five-field cron expression (minute, hour,
+// day of month, month, day of week) or one of the @hourly, @daily, @weekly,
+// @monthly and @yearly descriptors. Cron schedules are evaluated in loc.
+func Parse(spec string, loc *time.Location) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, err
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("schedule %q must have a positive interval", spec)
+		}
+		return Every(interval), nil
+	}
+	if expr, ok := descriptors[spec]; ok {
+		spec = expr
+	}
+	return parseCron(spec, loc)
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Cron activates at the times matching a cron expression. Each field is a
+// bit set of the values it matches.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record an unrestricted day field, as a day matches
+	// either restricted day field when both are restricted.
+	domStar, dowStar bool
+	loc              *time.Location
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Day of week 7 is Sunday too.
+	dowField = field{name: "day of week", min: 0, max: 7, names: weekdayNames}
+)
+
+var weekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+func parseCron(spec string, loc *time.Location) (*Cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, got %d", spec, len(fields))
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	c := &Cron{loc: loc, domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	var err error
+	for i, target := range []struct {
+		bits  *uint64
+		field field
+	}{
+		{&c.minute, minuteField},
+		{&c.hour, hourField},
+		{&c.dom, domField},
+		{&c.month, monthField},
+		{&c.dow, dowField},
+	} {
+		if *target.bits, err = target.field.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("cron expression %q: %v", spec, err)
+		}
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+// parse reads a comma separated list of *, values and ranges, each with an
+// optional /step.
+func (f field) parse(expr string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepExpr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, stepExpr)
+			}
+		}
+		low, high := f.min, f.max
+		if rangeExpr != "*" {
+			lowExpr, highExpr, isRange := strings.Cut(rangeExpr, "-")
+			var err error
+			if low, err = f.value(lowExpr); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = f.value(highExpr); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = f.max
+			}
+			if high < low {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, rangeExpr)
+			}
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(expr string) (int, error) {
+	if v, ok := f.names[strings.ToLower(expr)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(expr)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, must be between %d and %d", f.name, expr, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first matching minute strictly after t, or the zero time
+// when none matches within five years, as for February 30th.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Calendar holds the trading sessions of a market: opening hours on trading
+// days, except on holidays. A session closing before it opens ends on the
+// next day.
+type Calendar struct {
+	loc      *time.Location
+	days     uint8
+	open     time.Duration
+	close    time.Duration
+	holidays map[string]bool
+}
+
+const dateLayout = "2006-01-02"
+
+// NewCalendar builds a calendar from an IANA timezone, empty for UTC, a list
+// of days such as "mon-fri" or "sun,tue-thu", opening and closing times as
+// "15:04", with "24:00" for midnight, and holidays as "2006-01-02".
+func NewCalendar(timezone, days, open, close string, holidays []string) (*Calendar, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %v", timezone, err)
+	}
+	c := &Calendar{loc: loc, holidays: make(map[string]bool)}
+	if c.days, err = parseDays(days); err != nil {
+		return nil, err
+	}
+	if c.open, err = parseClock(open); err != nil {
+		return nil, fmt.Errorf("invalid opening time: %v", err)
+	}
+	if c.close, err = parseClock(close); err != nil {
+		return nil, fmt.Errorf("invalid closing time: %v", err)
+	}
+	if c.open == c.close {
+		return nil, fmt.Errorf("opening and closing times must differ, got %s", open)
+	}
+	for _, holiday := range holidays {
+		date, err := time.Parse(dateLayout, holiday)
+		if err != nil {
+			return nil, fmt.Errorf("invalid holiday %q, must have the form %s", holiday, dateLayout)
+		}
+		c.holidays[date.Format(dateLayout)] = true
+	}
+	return c, nil
+}
+
+func parseDays(days string) (uint8, error) {
+	var set uint8
+	for _, part := range strings.Split(days, ",") {
+		lowExpr, highExpr, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		low, ok := weekdayNames[strings.ToLower(lowExpr)]
+		if !ok {
+			return 0, fmt.Errorf("invalid day %q", lowExpr)
+		}
+		high := low
+		if isRange {
+			if high, ok = weekdayNames[strings.ToLower(highExpr)]; !ok {
+				return 0, fmt.Errorf("invalid day %q", highExpr)
+			}
+		}
+		// Ranges may wrap around the week, as fri-mon.
+		for day := low; ; day = (day + 1) % 7 {
+			set |= 1 << day
+			if day == high {
+				break
+			}
+		}
+	}
+	if bits.OnesCount8(set) == 0 {
+		return 0, fmt.Errorf("no trading day")
+	}
+	return set, nil
+}
+
+func parseClock(clock string) (time.Duration, error) {
+	hourExpr, minuteExpr, ok := strings.Cut(clock, ":")
+	hour, herr := strconv.Atoi(hourExpr)
+	minute, merr := strconv.Atoi(minuteExpr)
+	if !ok || herr != nil || merr != nil || hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("%q must have the form 15:04", clock)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// IsOpen reports whether t falls in a trading session.
+func (c *Calendar) IsOpen(t time.Time) bool {
+	local := t.In(c.loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, c.loc)
+	sinceMidnight := local.Sub(midnight)
+	if c.close > c.open {
+		return c.tradingDay(midnight) && sinceMidnight >= c.open && sinceMidnight < c.close
+	}
+	if c.tradingDay(midnight) && sinceMidnight >= c.open {
+		return true
+	}
+	return c.tradingDay(midnight.AddDate(0, 0, -1)) && sinceMidnight < c.close
+}
+
+func (c *Calendar) tradingDay(day time.Time) bool {
+	return c.days&(1<<uint(day.Weekday())) != 0 && !c.holidays[day.Format(dateLayout)]
+}
@@ -0,0 +1,112 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	tests := []struct {
+		spec string
+		loc  *time.Location
+		from string
+		want string
+	}{
+		{"@every 90s", time.UTC, "2026-03-02T10:00:00Z", "2026-03-02T10:01:30Z"},
+		{"@hourly", time.UTC, "2026-03-02T10:00:00Z", "2026-03-02T11:00:00Z"},
+		{"0 * * * *", time.UTC, "2026-03-02T10:59:59Z", "2026-03-02T11:00:00Z"},
+		{"*/15 * * * *", time.UTC, "2026-03-02T10:16:00Z", "2026-03-02T10:30:00Z"},
+		{"30 9-16/2 * * *", time.UTC, "2026-03-02T17:00:00Z", "2026-03-03T09:30:00Z"},
+		{"0 12 * * mon-fri", time.UTC, "2026-03-06T13:00:00Z", "2026-03-09T12:00:00Z"},
+		{"0 0 * * 7", time.UTC, "2026-03-02T00:00:00Z", "2026-03-08T00:00:00Z"},
+		{"0 0 1 jan,jul *", time.UTC, "2026-03-02T00:00:00Z", "2026-07-01T00:00:00Z"},
+		// Restricted days of month and week match either.
+		{"0 0 15 * fri", time.UTC, "2026-03-07T00:00:00Z", "2026-03-13T00:00:00Z"},
+		{"0 0 29 2 *", time.UTC, "2026-03-02T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"0 16 * * *", newYork, "2026-03-02T20:00:00Z", "2026-03-02T21:00:00Z"},
+		{"0 0 30 2 *", time.UTC, "2026-03-02T00:00:00Z", "0001-01-01T00:00:00Z"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.spec, func(t *testing.T) {
+			schedule, err := Parse(tc.spec, tc.loc)
+			require.NoError(t, err)
+			from, err := time.Parse(time.RFC3339, tc.from)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, schedule.Next(from).UTC().Format(time.RFC3339))
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"", "hourly", "@every", "@every -1m", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "* * * * mon-"} {
+		t.Run(spec, func(t *testing.T) {
+			_, err := Parse(spec, time.UTC)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	calendar, err := NewCalendar("America/New_York", "mon-fri", "09:30", "16:00", []string{"2026-12-25"})
+	require.NoError(t, err)
+	for at, open := range map[string]bool{
+		"2026-03-02T14:30:00Z": true,  // Monday 09:30
+		"2026-03-02T14:29:59Z": false, // Monday 09:29
+		"2026-03-02T21:00:00Z": false, // Monday 16:00
+		"2026-03-07T15:00:00Z": false, // Saturday
+		"2026-12-25T15:00:00Z": false, // Christmas
+		"2026-12-24T15:00:00Z": true,
+	} {
+		now, err := time.Parse(time.RFC3339, at)
+		require.NoError(t, err)
+		assert.Equal(t, open, calendar.IsOpen(now), at)
+	}
+}
+
+func TestOvernightCalendar(t *testing.T) {
+	// An FX week opening on Sunday 17:00 and closing on Friday 17:00.
+	calendar, err := NewCalendar("", "sun-thu", "17:00", "17:00", nil)
+	require.Error(t, err)
+	assert.Nil(t, calendar)
+
+	calendar, err = NewCalendar("", "sun-thu", "17:00", "16:59", []string{"2026-03-04"})
+	require.NoError(t, err)
+	for at, open := range map[string]bool{
+		"2026-03-01T16:59:00Z": false, // Sunday before the open
+		"2026-03-01T17:00:00Z": true,  // Sunday session
+		"2026-03-02T03:00:00Z": true,  // Sunday session, on Monday
+		"2026-03-04T18:00:00Z": false, // Wednesday holiday
+		"2026-03-05T03:00:00Z": false, // Wednesday holiday session, on Thursday
+		"2026-03-06T16:00:00Z": true,  // Thursday session, on Friday
+		"2026-03-06T17:00:00Z": false, // Friday
+		"2026-03-07T12:00:00Z": false, // Saturday
+	} {
+		now, err := time.Parse(time.RFC3339, at)
+		require.NoError(t, err)
+		assert.Equal(t, open, calendar.IsOpen(now), at)
+	}
+}
+
+func TestCalendarWrappingDays(t *testing.T) {
+	calendar, err := NewCalendar("UTC", "fri-mon", "00:00", "24:00", nil)
+	require.NoError(t, err)
+	assert.True(t, calendar.IsOpen(time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)))   // Sunday
+	assert.False(t, calendar.IsOpen(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC))) // Tuesday
+
+	for _, args := range [][]string{
+		{"Mars/Olympus", "mon-fri", "00:00", "24:00"},
+		{"UTC", "mon-fry", "00:00", "24:00"},
+		{"UTC", "mon-fri", "9:60", "24:00"},
+		{"UTC", "mon-fri", "00:00", "24:01"},
+	} {
+		_, err := NewCalendar(args[0], args[1], args[2], args[3], nil)
+		assert.Error(t, err, args)
+	}
+	_, err = NewCalendar("UTC", "mon-fri", "00:00", "24:00", []string{"25/12/2026"})
+	assert.Error(t, err)
+}